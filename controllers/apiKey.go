@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKey creates a scoped API key
+// @Summary Create an API key
+// @Description Create a scoped API key for a server-to-server integration (admin only). The key is only returned once.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateAPIKeyRequest true "API key details"
+// @Success 201 {object} dto.CreateAPIKeyResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	var input dto.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	for _, scope := range input.Scopes {
+		if !isKnownScope(scope) {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Unknown scope: " + scope})
+			return
+		}
+	}
+
+	if input.ExpiresAt != nil && input.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Expiry must be in the future"})
+		return
+	}
+
+	key, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to generate API key"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	apiKey := models.APIKey{
+		Name:        input.Name,
+		Prefix:      prefix,
+		KeyHash:     hash,
+		Scopes:      strings.Join(input.Scopes, " "),
+		ExpiresAt:   input.ExpiresAt,
+		CreatedById: userIDUint,
+	}
+	if err := db.DB.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.CreateAPIKeyResponse{
+		APIKeyResponse: mapToAPIKeyDTO(apiKey),
+		Key:            key,
+	})
+}
+
+// GetAPIKeys lists all API keys
+// @Summary Get API keys
+// @Description Retrieve all API keys without their secrets (admin only)
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} dto.APIKeyResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /api-keys [get]
+func GetAPIKeys(c *gin.Context) {
+	var apiKeys []models.APIKey
+	if err := db.DB.Order("created_at DESC").Find(&apiKeys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch API keys"})
+		return
+	}
+
+	var apiKeyResponses []dto.APIKeyResponse
+	for _, apiKey := range apiKeys {
+		apiKeyResponses = append(apiKeyResponses, mapToAPIKeyDTO(apiKey))
+	}
+
+	c.JSON(http.StatusOK, apiKeyResponses)
+}
+
+// RevokeAPIKey revokes an API key
+// @Summary Revoke an API key
+// @Description Revoke an API key so it can no longer be used (admin only)
+// @Tags api-keys
+// @Produce json
+// @Param id path uint true "API key ID"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	apiKeyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid API key ID"})
+		return
+	}
+
+	var apiKey models.APIKey
+	if err := db.DB.First(&apiKey, apiKeyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "API key not found"})
+		return
+	}
+
+	// Keep the row so audit records still resolve to a key name
+	if apiKey.RevokedAt == nil {
+		if err := db.DB.Model(&apiKey).Update("revoked_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to revoke API key"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "API key revoked"})
+}
+
+// GetAPIKeyAuditLog lists the requests made with an API key
+// @Summary Get API key audit log
+// @Description Retrieve the latest requests made with an API key (admin only)
+// @Tags api-keys
+// @Produce json
+// @Param id path uint true "API key ID"
+// @Success 200 {array} dto.AuditLogResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /api-keys/{id}/audit [get]
+func GetAPIKeyAuditLog(c *gin.Context) {
+	apiKeyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid API key ID"})
+		return
+	}
+
+	var auditLogs []models.AuditLog
+	if err := db.DB.Where("actor_type = ? AND actor_id = ?", "api_key", apiKeyID).
+		Order("created_at DESC").Limit(500).Find(&auditLogs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapToAuditLogDTOs(auditLogs))
+}
+
+// isKnownScope reports whether a scope can be granted to an API key
+func isKnownScope(scope string) bool {
+	for _, known := range utils.APIKeyScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// mapToAPIKeyDTO maps an API key to its response DTO
+func mapToAPIKeyDTO(apiKey models.APIKey) dto.APIKeyResponse {
+	return dto.APIKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     strings.Fields(apiKey.Scopes),
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		RevokedAt:  apiKey.RevokedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
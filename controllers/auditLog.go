@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"net/http"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAuditLogs lists audit log entries
+// @Summary Get audit logs
+// @Description Retrieve the latest audit log entries, optionally filtered by actor and subject (admin only)
+// @Tags audit
+// @Produce json
+// @Param actorType query string false "Actor type, e.g. api_key or impersonation"
+// @Param actorId query uint false "Actor ID"
+// @Param subjectId query uint false "ID of the user acted on behalf of"
+// @Success 200 {array} dto.AuditLogResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /audit-logs [get]
+func GetAuditLogs(c *gin.Context) {
+	query := db.DB.Order("created_at DESC").Limit(500)
+	if actorType := c.Query("actorType"); actorType != "" {
+		query = query.Where("actor_type = ?", actorType)
+	}
+	if actorID := c.Query("actorId"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if subjectID := c.Query("subjectId"); subjectID != "" {
+		query = query.Where("subject_id = ?", subjectID)
+	}
+
+	var auditLogs []models.AuditLog
+	if err := query.Find(&auditLogs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapToAuditLogDTOs(auditLogs))
+}
+
+// mapToAuditLogDTOs maps audit log entries to response DTOs
+func mapToAuditLogDTOs(auditLogs []models.AuditLog) []dto.AuditLogResponse {
+	var auditLogDTOs []dto.AuditLogResponse
+	for _, auditLog := range auditLogs {
+		auditLogDTOs = append(auditLogDTOs, dto.AuditLogResponse{
+			ID:        auditLog.ID,
+			ActorType: auditLog.ActorType,
+			ActorID:   auditLog.ActorID,
+			SubjectID: auditLog.SubjectId,
+			Method:    auditLog.Method,
+			Path:      auditLog.Path,
+			Status:    auditLog.Status,
+			IP:        auditLog.IP,
+			UserAgent: auditLog.UserAgent,
+			Details:   auditLog.Details,
+			CreatedAt: auditLog.CreatedAt,
+		})
+	}
+	return auditLogDTOs
+}
@@ -7,19 +7,24 @@ import (
 	"e-commerce/db"
 	"e-commerce/dto"
 	"e-commerce/models"
+	"e-commerce/storage"
+	"e-commerce/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AddToCart adds a product to the user's cart
 // @Summary Add a product to the cart
-// @Description Add a specific product to the user's cart
+// @Description Add a specific product to the user's cart. Anonymous visitors get a guest cart identified by the X-Cart-Token header.
 // @Tags cart
 // @Accept json
 // @Produce json
 // @Param AddToCartRequest body dto.AddToCartRequest true "Add to Cart Request"
+// @Param X-Cart-Token header string false "Guest cart token for anonymous visitors"
 // @Success 200 {object} dto.CartItemResponse
+// @Header 200 {string} X-Cart-Token "Token of a newly started guest cart"
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @securityDefinitions.apiKey Authorization
 // @in header
@@ -37,9 +42,6 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
-	userID, _ := c.Get("userID")
-	userIDUint, _ := userID.(uint)
-
 	// Check if the product exists
 	var product models.Product
 	if err := db.DB.First(&product, input.ProductID).Error; err != nil {
@@ -47,22 +49,41 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
+	owner, err := resolveCartOwner(c, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create cart"})
+		return
+	}
+	touchGuestCart(owner)
+
 	// Create or update the cart item
 	var cartItem models.Cart
-	if err := db.DB.Where("user_id = ? AND product_id = ?", userIDUint, input.ProductID).First(&cartItem).Error; err != nil {
+	existing := owner.scope(db.DB).Where("product_id = ?", input.ProductID).First(&cartItem).Error == nil
+
+	// Adding to an existing line is checked against the quantity it ends up with
+	if qe := checkCartQuantity(owner, product, cartItem.Quantity+input.Quantity); qe != nil {
+		qe.respond(c)
+		return
+	}
+
+	if !existing {
 		// Create new cart item
 		cartItem = models.Cart{
-			UserId:    userIDUint,
-			ProductId: input.ProductID,
-			Quantity:  input.Quantity,
+			UserId:      owner.UserID,
+			GuestCartId: owner.GuestCartID,
+			ProductId:   input.ProductID,
+			Quantity:    input.Quantity,
+			PriceAtAdd:  product.Price,
 		}
 		if err := db.DB.Create(&cartItem).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to add item to cart"})
 			return
 		}
 	} else {
-		// Update existing cart item
+		// Update existing cart item, bringing it back into the cart if it was saved for later
 		cartItem.Quantity += input.Quantity
+		cartItem.SavedForLater = false
+		cartItem.PriceAtAdd = product.Price
 		if err := db.DB.Save(&cartItem).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to update cart item"})
 			return
@@ -74,10 +95,11 @@ func AddToCart(c *gin.Context) {
 
 // ViewCart retrieves the user's cart items
 // @Summary View cart items
-// @Description Retrieve all items in the user's cart
+// @Description Retrieve all items in the user's cart or the guest cart with line subtotals and a price summary. Items saved for later are listed separately and not included in the summary. The cart carries an impersonation flag while an admin is acting as the user. Breaking change: the response used to be a bare array of cart items and is now an object with `items` and `savedForLater`.
 // @Tags cart
 // @Produce json
-// @Success 200 {array} dto.CartItemResponse
+// @Param X-Cart-Token header string false "Guest cart token for anonymous visitors"
+// @Success 200 {object} dto.CartResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @securityDefinitions.apiKey Authorization
 // @in header
@@ -85,45 +107,157 @@ func AddToCart(c *gin.Context) {
 // @Security JWT
 // @Router /cart [get]
 func ViewCart(c *gin.Context) {
-	userID, _ := c.Get("userID")
-	userIDUint, _ := userID.(uint)
+	cartResponse := dto.CartResponse{
+		Items:         []dto.CartItemResponse{},
+		SavedForLater: []dto.CartItemResponse{},
+		Impersonation: impersonationNotice(c),
+	}
+
+	owner, _ := resolveCartOwner(c, false)
+	if !owner.exists() {
+		c.JSON(http.StatusOK, cartResponse)
+		return
+	}
+	touchGuestCart(owner)
 
 	var cartItems []models.Cart
 
 	// Fetch cart items with preloaded product details
-	if err := db.DB.Preload("Product").Where("user_id = ?", userIDUint).Find(&cartItems).Error; err != nil {
+	if err := owner.scope(db.DB.Preload("Product")).Order("id").Find(&cartItems).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch cart items"})
 		return
 	}
 
-	// Define a slice to hold the formatted response
-	var cartResponse []gin.H
-
-	// Iterate through each cart item and format the response
+	var inCart []models.Cart
 	for _, cart := range cartItems {
-		cartResponse = append(cartResponse, gin.H{
-			"id":        cart.ID,
-			"productId": cart.ProductId,
-			"product": gin.H{
-				"id":          cart.Product.ID,
-				"name":        cart.Product.Name,
-				"description": cart.Product.Description,
-				"price":       cart.Product.Price,
-				"photo":       cart.Product.Photo,
-			},
-			"quantity": cart.Quantity,
-		})
+		if cart.SavedForLater {
+			cartResponse.SavedForLater = append(cartResponse.SavedForLater, mapToCartItemDTO(cart, utils.PricedLine{}))
+		} else {
+			inCart = append(inCart, cart)
+		}
 	}
 
+	// Price the cart with the same code path checkout uses
+	pricing := utils.PriceCart(inCart)
+	linesByID := map[uint]utils.PricedLine{}
+	for _, line := range pricing.Lines {
+		linesByID[line.Item.ID] = line
+	}
+	for _, cart := range inCart {
+		cartResponse.Items = append(cartResponse.Items, mapToCartItemDTO(cart, linesByID[cart.ID]))
+	}
+
+	cartResponse.Summary = mapToCartSummaryDTO(pricing)
+
 	c.JSON(http.StatusOK, cartResponse)
 }
 
+// mapToCartSummaryDTO maps a cart price breakdown to the cart summary DTO
+func mapToCartSummaryDTO(pricing utils.CartPricing) dto.CartSummary {
+	return dto.CartSummary{
+		ItemCount: pricing.ItemCount,
+		Subtotal:  pricing.Subtotal,
+		Discount:  pricing.Discount,
+		Tax:       pricing.Tax,
+		Shipping:  pricing.Shipping,
+		Total:     pricing.Total,
+	}
+}
+
+// mapToCartItemDTO maps a cart item and its priced line to the cart item response DTO
+func mapToCartItemDTO(cart models.Cart, line utils.PricedLine) dto.CartItemResponse {
+	return dto.CartItemResponse{
+		ID:           cart.ID,
+		ProductID:    cart.ProductId,
+		Product:      mapToProductDetail(cart.Product),
+		Quantity:     cart.Quantity,
+		UnitPrice:    line.UnitPrice,
+		LineSubtotal: line.Subtotal,
+	}
+}
+
+// SaveForLater moves a cart item to the "save for later" section
+// @Summary Save a cart item for later
+// @Description Move an item out of the cart into the "save for later" section. Saved items are not ordered at checkout.
+// @Tags cart
+// @Produce json
+// @Param id path uint true "Cart Item ID"
+// @Param X-Cart-Token header string false "Guest cart token for anonymous visitors"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /cart/{id}/save-for-later [post]
+func SaveForLater(c *gin.Context) {
+	setSavedForLater(c, true, "Item saved for later")
+}
+
+// MoveToCart moves a saved item back into the cart
+// @Summary Move a saved item to the cart
+// @Description Move an item from the "save for later" section back into the cart
+// @Tags cart
+// @Produce json
+// @Param id path uint true "Cart Item ID"
+// @Param X-Cart-Token header string false "Guest cart token for anonymous visitors"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /cart/{id}/move-to-cart [post]
+func MoveToCart(c *gin.Context) {
+	setSavedForLater(c, false, "Item moved to cart")
+}
+
+// setSavedForLater moves a cart item between the cart and the "save for later" section
+func setSavedForLater(c *gin.Context, saved bool, message string) {
+	cartID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid cart item ID"})
+		return
+	}
+
+	owner, _ := resolveCartOwner(c, false)
+	var cartItem models.Cart
+	if !owner.exists() || owner.scope(db.DB).Where("id = ?", cartID).First(&cartItem).Error != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Cart item not found"})
+		return
+	}
+
+	if err := db.DB.Model(&cartItem).Update("saved_for_later", saved).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to update cart item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: message})
+}
+
+// mapToProductDetail maps a product to the product details shown in carts and wishlists
+func mapToProductDetail(product models.Product) dto.ProductDetail {
+	return dto.ProductDetail{
+		ID:          product.ID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Photo:       storage.URL(product.PhotoKey, product.Photo),
+		InStock:     product.Stock == nil || *product.Stock > 0,
+	}
+}
+
 // RemoveFromCart removes an item from the user's cart
 // @Summary Remove an item from the cart
 // @Description Remove a specific item from the user's cart by cart item ID
 // @Tags cart
 // @Produce json
 // @Param id path uint true "Cart Item ID"
+// @Param X-Cart-Token header string false "Guest cart token for anonymous visitors"
 // @Success 200 {object} dto.SuccessResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
@@ -141,12 +275,10 @@ func RemoveFromCart(c *gin.Context) {
 		return
 	}
 
-	userID, _ := c.Get("userID")
-	userIDUint, _ := userID.(uint)
-
 	// Check if the cart item exists
+	owner, _ := resolveCartOwner(c, false)
 	var cartItem models.Cart
-	if err := db.DB.Where("id = ? AND user_id = ?", cartID, userIDUint).First(&cartItem).Error; err != nil {
+	if !owner.exists() || owner.scope(db.DB).Where("id = ?", cartID).First(&cartItem).Error != nil {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Cart item not found"})
 		return
 	}
@@ -163,15 +295,17 @@ func RemoveFromCart(c *gin.Context) {
 
 // UpdateCartItem updates the quantity of a specific item in the user's cart
 // @Summary Update cart item quantity
-// @Description Update the quantity of a specific item in the user's cart by cart item ID
+// @Description Update the quantity of a specific item in the user's cart by cart item ID. A quantity of 0 removes the item.
 // @Tags cart
 // @Accept json
 // @Produce json
 // @Param id path uint true "Cart Item ID"
 // @Param UpdateQuantity body dto.UpdateQuantity true "Change quantity"
+// @Param X-Cart-Token header string false "Guest cart token for anonymous visitors"
 // @Success 200 {object} dto.CartItemResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @securityDefinitions.apiKey Authorization
 // @in header
@@ -179,9 +313,7 @@ func RemoveFromCart(c *gin.Context) {
 // @Security JWT
 // @Router /cart/{id} [put]
 func UpdateCartItem(c *gin.Context) {
-	var input struct {
-		Quantity uint `json:"quantity" binding:"required"`
-	}
+	var input dto.UpdateQuantity
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
@@ -195,18 +327,32 @@ func UpdateCartItem(c *gin.Context) {
 		return
 	}
 
-	userID, _ := c.Get("userID")
-	userIDUint, _ := userID.(uint)
-
 	// Check if the cart item exists
+	owner, _ := resolveCartOwner(c, false)
 	var cartItem models.Cart
-	if err := db.DB.Where("id = ? AND user_id = ?", cartID, userIDUint).First(&cartItem).Error; err != nil {
+	if !owner.exists() || owner.scope(db.DB.Preload("Product")).Where("id = ?", cartID).First(&cartItem).Error != nil {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Cart item not found"})
 		return
 	}
+	touchGuestCart(owner)
+
+	// A quantity of 0 removes the item
+	if *input.Quantity == 0 {
+		if err := db.DB.Delete(&cartItem).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to remove item from cart"})
+			return
+		}
+		c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Item removed from cart"})
+		return
+	}
+
+	if qe := checkCartQuantity(owner, cartItem.Product, *input.Quantity); qe != nil {
+		qe.respond(c)
+		return
+	}
 
 	// Update the quantity
-	cartItem.Quantity = input.Quantity
+	cartItem.Quantity = *input.Quantity
 	if err := db.DB.Save(&cartItem).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to update cart item"})
 		return
@@ -214,3 +360,16 @@ func UpdateCartItem(c *gin.Context) {
 
 	c.JSON(http.StatusOK, cartItem)
 }
+
+// checkCartQuantity checks a cart line quantity against the product's rules. Purchase
+// limits are checked here for logged-in users; guests are checked at checkout once
+// their email is known.
+func checkCartQuantity(owner cartOwner, product models.Product, quantity uint) *quantityError {
+	if qe := checkQuantity(product, quantity); qe != nil {
+		return qe
+	}
+	if owner.UserID == nil {
+		return nil
+	}
+	return checkPurchaseLimit(product, quantity, purchasedQuantity(db.DB, product.ID, owner.UserID, ""))
+}
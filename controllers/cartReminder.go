@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errCodeCouponInvalid is returned when a coupon cannot be used for the order
+const errCodeCouponInvalid = "coupon_invalid"
+
+// RestoreCart opens an abandoned cart from the link in a reminder email
+// @Summary Restore an abandoned cart
+// @Description Show the cart a reminder email was sent about, priced with the reminder's coupon while it can still be used. Opening the link is recorded for the abandoned cart report.
+// @Tags cart
+// @Produce json
+// @Param token path string true "Signed cart restore token from the reminder email"
+// @Success 200 {object} dto.RestoreCartResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 410 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /cart/restore/{token} [get]
+func RestoreCart(c *gin.Context) {
+	token := c.Param("token")
+
+	var reminder models.CartReminder
+	var user models.User
+	reminderID, ok := utils.LinkID(token)
+	if !ok ||
+		db.DB.Preload("Coupon").First(&reminder, reminderID).Error != nil ||
+		db.DB.Where("deactivated_at IS NULL").First(&user, reminder.UserId).Error != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Cart not found"})
+		return
+	}
+	issuedAt, ok := utils.ValidLink(utils.LinkCartRestore, token, reminder.ID, user.Email)
+	if !ok {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Cart not found"})
+		return
+	}
+
+	linkLifetime := time.Duration(utils.GetEnvInt("ABANDONED_CART_LINK_DAYS", 14)) * 24 * time.Hour
+	if time.Since(issuedAt) > linkLifetime {
+		c.JSON(http.StatusGone, dto.ErrorResponse{Error: "This link has expired"})
+		return
+	}
+
+	if reminder.ClickedAt == nil {
+		db.DB.Model(&reminder).Where("clicked_at IS NULL").Update("clicked_at", time.Now())
+	}
+
+	var cartItems []models.Cart
+	if err := db.DB.Preload("Product").Where("user_id = ? AND saved_for_later = ?", user.ID, false).
+		Order("id").Find(&cartItems).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch cart items"})
+		return
+	}
+
+	response := dto.RestoreCartResponse{Items: []dto.CartItemResponse{}}
+
+	var discounts []utils.Discount
+	if reminder.Coupon != nil && couponUsable(*reminder.Coupon, user.ID) {
+		discounts = append(discounts, utils.PercentDiscount(reminder.Coupon.Percent))
+		response.CouponCode = reminder.Coupon.Code
+		response.CouponExpiresAt = &reminder.Coupon.ExpiresAt
+	}
+
+	pricing := utils.PriceCart(cartItems, discounts...)
+	for _, line := range pricing.Lines {
+		response.Items = append(response.Items, mapToCartItemDTO(line.Item, line))
+	}
+	response.Summary = mapToCartSummaryDTO(pricing)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetAbandonedCartReport reports how many abandoned carts reminder emails recovered
+// @Summary Abandoned cart report
+// @Description Reminders sent, links opened, carts recovered with their revenue and coupons redeemed for reminders sent in the period. Defaults to the last 30 days.
+// @Tags reports
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} dto.AbandonedCartReport
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /reports/abandoned-carts [get]
+func GetAbandonedCartReport(c *gin.Context) {
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+
+	report := dto.AbandonedCartReport{From: from, To: to}
+	reminders := func() *gorm.DB {
+		return db.DB.Model(&models.CartReminder{}).Where("cart_reminders.sent_at IS NOT NULL AND cart_reminders.created_at >= ? AND cart_reminders.created_at < ?", from, to)
+	}
+
+	err := reminders().Count(&report.RemindersSent).Error
+	if err == nil {
+		err = reminders().Where("sequence = ?", 1).Count(&report.CartsReminded).Error
+	}
+	if err == nil {
+		err = reminders().Where("clicked_at IS NOT NULL").Count(&report.LinksClicked).Error
+	}
+	if err == nil {
+		err = reminders().Where("order_id IS NOT NULL").Distinct("order_id").Count(&report.CartsRecovered).Error
+	}
+	if err == nil {
+		recoveredOrders := reminders().Select("order_id").Where("order_id IS NOT NULL")
+		err = db.DB.Model(&models.Order{}).Where("id IN (?)", recoveredOrders).
+			Select("COALESCE(SUM(bill), 0)").Scan(&report.RecoveredRevenue).Error
+	}
+	if err == nil {
+		err = reminders().Where("coupon_id IS NOT NULL").Count(&report.CouponsIssued).Error
+	}
+	if err == nil {
+		err = reminders().Joins("JOIN coupons ON coupons.id = cart_reminders.coupon_id").
+			Where("coupons.used_at IS NOT NULL").Count(&report.CouponsRedeemed).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to build report"})
+		return
+	}
+
+	if report.CartsReminded > 0 {
+		report.RecoveryRate = float64(report.CartsRecovered) / float64(report.CartsReminded)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// findUsableCoupon looks up a coupon code for the user's checkout. On failure the error
+// response is written and false is returned.
+func findUsableCoupon(c *gin.Context, code string, userID uint) (*models.Coupon, bool) {
+	var coupon models.Coupon
+	if err := db.DB.Where("code = ?", strings.ToUpper(strings.TrimSpace(code))).First(&coupon).Error; err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Coupon not found", Code: errCodeCouponInvalid})
+		return nil, false
+	}
+	if !couponUsable(coupon, userID) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Coupon is expired or has already been used", Code: errCodeCouponInvalid})
+		return nil, false
+	}
+	return &coupon, true
+}
+
+// couponUsable reports whether the user can still redeem the coupon
+func couponUsable(coupon models.Coupon, userID uint) bool {
+	if coupon.UsedAt != nil || time.Now().After(coupon.ExpiresAt) {
+		return false
+	}
+	return coupon.UserId == nil || *coupon.UserId == userID
+}
+
+// markCartRecovered credits an order to the reminders recently sent to the user about
+// their abandoned cart
+func markCartRecovered(userID uint, orderID uint) {
+	window := time.Duration(utils.GetEnvInt("ABANDONED_CART_RECOVERY_DAYS", 7)) * 24 * time.Hour
+	db.DB.Model(&models.CartReminder{}).
+		Where("user_id = ? AND sent_at IS NOT NULL AND recovered_at IS NULL AND created_at > ?", userID, time.Now().Add(-window)).
+		Updates(map[string]interface{}{"recovered_at": time.Now(), "order_id": orderID})
+}
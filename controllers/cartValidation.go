@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	cartIssuePriceChanged       = "price_changed"
+	cartIssueProductUnavailable = "product_unavailable"
+	cartIssueInsufficientStock  = "insufficient_stock"
+	cartIssueQuantityReduced    = "quantity_reduced"
+	cartIssuePurchaseLimit      = errCodePurchaseLimit
+	cartIssueMovedFromSaved     = "moved_from_saved_for_later"
+)
+
+// ValidateCart reports what changed in the cart since the items were added
+// @Summary Validate the cart
+// @Description Report price changes, deleted products and stock shortfalls since the items were added. With acknowledge set, the reported lines are updated: changed prices are accepted, unavailable items are removed and quantities are reduced to the largest one the stock and quantity rules allow, so checkout can proceed. The acknowledged issues are then listed separately, and issues lists whatever is still wrong with the cart after the update.
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param X-Cart-Token header string false "Guest cart token for anonymous visitors"
+// @Param request body dto.ValidateCartRequest false "Acknowledge the reported changes"
+// @Success 200 {object} dto.CartValidationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /cart/validate [post]
+func ValidateCart(c *gin.Context) {
+	var input dto.ValidateCartRequest
+	if !bindOptionalJSON(c, &input) {
+		return
+	}
+
+	owner, _ := resolveCartOwner(c, false)
+	if !owner.exists() {
+		c.JSON(http.StatusOK, dto.CartValidationResponse{Valid: true, Issues: []dto.CartIssue{}})
+		return
+	}
+
+	cartItems, err := fetchCheckoutItems(db.DB, owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch cart items"})
+		return
+	}
+
+	issues := validateCartItems(cartItems)
+	if !input.Acknowledge || len(issues) == 0 {
+		c.JSON(http.StatusOK, dto.CartValidationResponse{Valid: len(issues) == 0, Issues: issues})
+		return
+	}
+
+	if err := acknowledgeCartIssues(cartItems, issues); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to update cart"})
+		return
+	}
+
+	// Products can change again while the cart is updated, so the cart is checked once more
+	cartItems, err = fetchCheckoutItems(db.DB, owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch cart items"})
+		return
+	}
+	remaining := validateCartItems(cartItems)
+
+	c.JSON(http.StatusOK, dto.CartValidationResponse{
+		Valid:        len(remaining) == 0,
+		Issues:       remaining,
+		Acknowledged: issues,
+	})
+}
+
+// fetchCheckoutItems loads the cart items that would be ordered. Deleted products are
+// loaded too, so they can be reported instead of silently dropped.
+func fetchCheckoutItems(tx *gorm.DB, owner cartOwner) ([]models.Cart, error) {
+	var cartItems []models.Cart
+	err := owner.scope(tx.Preload("Product", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() })).
+		Where("saved_for_later = ?", false).Order("id").Find(&cartItems).Error
+	return cartItems, err
+}
+
+// validateCartItems compares cart items with the current state of their products. A line
+// can have several issues, e.g. both a price change and a stock shortfall.
+func validateCartItems(cartItems []models.Cart) []dto.CartIssue {
+	issues := []dto.CartIssue{}
+	for _, item := range cartItems {
+		product := item.Product
+		newIssue := func(issueType string, message string) dto.CartIssue {
+			return dto.CartIssue{CartItemID: item.ID, ProductID: item.ProductId, Name: product.Name, Type: issueType, Message: message}
+		}
+
+		if product.ID == 0 || product.DeletedAt.Valid {
+			issues = append(issues, newIssue(cartIssueProductUnavailable, fmt.Sprintf("%s is no longer available", product.Name)))
+			continue
+		}
+		if product.Stock != nil && item.Quantity > *product.Stock {
+			issue := newIssue(cartIssueInsufficientStock, fmt.Sprintf("Only %d of %s left in stock", *product.Stock, product.Name))
+			issue.Available = product.Stock
+			issues = append(issues, issue)
+		}
+		// Items added before prices were recorded have no price to compare against
+		if item.PriceAtAdd != 0 && item.PriceAtAdd != product.Price {
+			issue := newIssue(cartIssuePriceChanged, fmt.Sprintf("The price of %s changed from %.2f to %.2f", product.Name, item.PriceAtAdd, product.Price))
+			issue.PreviousPrice = item.PriceAtAdd
+			issue.CurrentPrice = product.Price
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// acknowledgeCartIssues brings the lines with reported issues in line with the current
+// products: reported prices are updated, unavailable items removed and quantities reduced to
+// the largest one the stock and quantity rules allow. Lines without an issue are left alone.
+func acknowledgeCartIssues(cartItems []models.Cart, issues []dto.CartIssue) error {
+	reported := make(map[uint]map[string]bool)
+	for _, issue := range issues {
+		if reported[issue.CartItemID] == nil {
+			reported[issue.CartItemID] = make(map[string]bool)
+		}
+		reported[issue.CartItemID][issue.Type] = true
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, item := range cartItems {
+			itemIssues := reported[item.ID]
+			if itemIssues == nil {
+				continue
+			}
+
+			quantity := item.Quantity
+			if itemIssues[cartIssueInsufficientStock] {
+				quantity = fitQuantity(item.Product, item.Quantity)
+			}
+			if itemIssues[cartIssueProductUnavailable] || quantity == 0 {
+				if err := tx.Delete(&item).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			updates := map[string]interface{}{"quantity": quantity}
+			if itemIssues[cartIssuePriceChanged] {
+				updates["price_at_add"] = item.Product.Price
+			}
+			if err := tx.Model(&item).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/jobs"
+	"e-commerce/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestDataExport queues an export of the current user's data
+// @Summary Request a data export
+// @Description Queue a JSON archive of the current user's profile, cart, saved items, wishlists, orders and order messages with their attachments. Poll the returned request for its status.
+// @Tags users
+// @Produce json
+// @Success 202 {object} dto.DataRequestResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/data-export [post]
+func RequestDataExport(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	createDataRequest(c, userIDUint, jobs.DataRequestExport)
+}
+
+// RequestErasure queues the anonymisation of the current user's personal data
+// @Summary Request account erasure
+// @Description Queue the erasure of the current user's personal data. Orders are kept anonymised for accounting retention and the account is deactivated. Accounts created through social login, which have no password, confirm with a login from the last REAUTH_MINUTES instead.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.PasswordConfirmationRequest true "Password"
+// @Success 202 {object} dto.DataRequestResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/erasure [post]
+func RequestErasure(c *gin.Context) {
+	var input dto.PasswordConfirmationRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !confirmIdentity(c, user, input.Password, "Invalid credentials") {
+		return
+	}
+
+	createDataRequest(c, user.ID, jobs.DataRequestErasure)
+}
+
+// GetDataRequests lists the current user's data requests
+// @Summary Get my data requests
+// @Description Retrieve the status of the current user's data export and erasure requests
+// @Tags users
+// @Produce json
+// @Success 200 {array} dto.DataRequestResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/data-requests [get]
+func GetDataRequests(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	var requests []models.DataRequest
+	if err := db.DB.Where("user_id = ?", userIDUint).Order("created_at DESC").Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch data requests"})
+		return
+	}
+
+	var requestResponses []dto.DataRequestResponse
+	for _, request := range requests {
+		requestResponses = append(requestResponses, mapToDataRequestDTO(request))
+	}
+
+	c.JSON(http.StatusOK, requestResponses)
+}
+
+// GetDataRequest returns the status of one data request
+// @Summary Get a data request
+// @Description Retrieve the status of one of the current user's data requests
+// @Tags users
+// @Produce json
+// @Param id path uint true "Data request ID"
+// @Success 200 {object} dto.DataRequestResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/data-requests/{id} [get]
+func GetDataRequest(c *gin.Context) {
+	request, ok := findDataRequest(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, mapToDataRequestDTO(request))
+}
+
+// DownloadDataExport downloads a finished data export
+// @Summary Download a data export
+// @Description Download the archive of a completed data export
+// @Tags users
+// @Produce application/zip
+// @Param id path uint true "Data request ID"
+// @Success 200 {file} file
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/data-requests/{id}/download [get]
+func DownloadDataExport(c *gin.Context) {
+	request, ok := findDataRequest(c)
+	if !ok {
+		return
+	}
+
+	if request.Type != jobs.DataRequestExport || request.Status != jobs.DataRequestCompleted ||
+		request.FilePath == "" || (request.ExpiresAt != nil && time.Now().After(*request.ExpiresAt)) {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Export is not available"})
+		return
+	}
+
+	c.FileAttachment(request.FilePath, fmt.Sprintf("data-export-%d.zip", request.ID))
+}
+
+// createDataRequest queues a request unless one of the same type is still in progress
+func createDataRequest(c *gin.Context, userID uint, requestType string) {
+	var inProgress int64
+	db.DB.Model(&models.DataRequest{}).
+		Where("user_id = ? AND type = ? AND status IN ?", userID, requestType, []string{jobs.DataRequestPending, jobs.DataRequestProcessing}).
+		Count(&inProgress)
+	if inProgress > 0 {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: "A request of this type is already in progress"})
+		return
+	}
+
+	request := models.DataRequest{
+		UserId: userID,
+		Type:   requestType,
+		Status: jobs.DataRequestPending,
+	}
+	if err := db.DB.Create(&request).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create data request"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, mapToDataRequestDTO(request))
+}
+
+// findDataRequest loads one of the current user's data requests from the id path parameter
+func findDataRequest(c *gin.Context) (models.DataRequest, bool) {
+	var request models.DataRequest
+
+	requestID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid data request ID"})
+		return request, false
+	}
+
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	if err := db.DB.Where("id = ? AND user_id = ?", requestID, userIDUint).First(&request).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Data request not found"})
+		return request, false
+	}
+	return request, true
+}
+
+// mapToDataRequestDTO maps a data request to its response DTO
+func mapToDataRequestDTO(request models.DataRequest) dto.DataRequestResponse {
+	response := dto.DataRequestResponse{
+		ID:          request.ID,
+		Type:        request.Type,
+		Status:      request.Status,
+		Error:       request.Error,
+		CreatedAt:   request.CreatedAt,
+		CompletedAt: request.CompletedAt,
+		ExpiresAt:   request.ExpiresAt,
+	}
+	if request.Type == jobs.DataRequestExport && request.FilePath != "" {
+		response.DownloadURL = fmt.Sprintf("/users/me/data-requests/%d/download", request.ID)
+	}
+	return response
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// cartTokenHeader carries the opaque token of an anonymous visitor's cart
+const cartTokenHeader = "X-Cart-Token"
+
+// cartOwner identifies whose cart a request works on: a logged-in user or a guest cart
+type cartOwner struct {
+	UserID      *uint
+	GuestCartID *uint
+}
+
+// exists reports whether there is a cart to work on
+func (o cartOwner) exists() bool {
+	return o.UserID != nil || o.GuestCartID != nil
+}
+
+// scope restricts a query to the owner's cart lines
+func (o cartOwner) scope(tx *gorm.DB) *gorm.DB {
+	if o.UserID != nil {
+		return tx.Where("user_id = ?", *o.UserID)
+	}
+	return tx.Where("guest_cart_id = ?", *o.GuestCartID)
+}
+
+// guestCartTTL is how long an untouched guest cart is kept
+func guestCartTTL() time.Duration {
+	return time.Duration(utils.GetEnvInt("GUEST_CART_TTL_DAYS", 30)) * 24 * time.Hour
+}
+
+// resolveCartOwner returns the cart of the logged-in user or the guest cart from the cart token.
+// With create set, a new guest cart is started for anonymous visitors and its token is
+// returned in the X-Cart-Token response header.
+func resolveCartOwner(c *gin.Context, create bool) (cartOwner, error) {
+	if userID, exists := c.Get("userID"); exists {
+		userIDUint, _ := userID.(uint)
+		return cartOwner{UserID: &userIDUint}, nil
+	}
+
+	if guestCart, ok := findGuestCart(db.DB, c.GetHeader(cartTokenHeader)); ok {
+		return cartOwner{GuestCartID: &guestCart.ID}, nil
+	}
+	if !create {
+		return cartOwner{}, nil
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return cartOwner{}, err
+	}
+	guestCart := models.GuestCart{
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(guestCartTTL()),
+	}
+	if err := db.DB.Create(&guestCart).Error; err != nil {
+		return cartOwner{}, err
+	}
+
+	c.Header(cartTokenHeader, token)
+	return cartOwner{GuestCartID: &guestCart.ID}, nil
+}
+
+// findGuestCart looks up an unexpired guest cart by its token
+func findGuestCart(tx *gorm.DB, token string) (models.GuestCart, bool) {
+	var guestCart models.GuestCart
+	if token == "" {
+		return guestCart, false
+	}
+	err := tx.Where("token_hash = ? AND expires_at > ?", utils.HashToken(token), time.Now()).First(&guestCart).Error
+	return guestCart, err == nil
+}
+
+// touchGuestCart keeps a guest cart alive while the visitor is still shopping
+func touchGuestCart(owner cartOwner) {
+	if owner.GuestCartID != nil {
+		db.DB.Model(&models.GuestCart{}).Where("id = ?", *owner.GuestCartID).
+			Update("expires_at", time.Now().Add(guestCartTTL()))
+	}
+}
+
+// exceedsStock reports whether a quantity is more than the product has in stock
+func exceedsStock(product models.Product, quantity uint) bool {
+	return product.Stock != nil && quantity > *product.Stock
+}
+
+// stockError describes how many items of a product are left
+func stockError(product models.Product) string {
+	return fmt.Sprintf("Only %d of %s left in stock", *product.Stock, product.Name)
+}
+
+// mergeGuestCart moves the guest cart from the X-Cart-Token header into the user's cart.
+// Quantities of products in both carts are summed and reduced to what the product's
+// quantity rules and stock allow.
+// A failed merge must not fail the login, so errors are only logged.
+func mergeGuestCart(c *gin.Context, userID uint) {
+	guestCart, ok := findGuestCart(db.DB, c.GetHeader(cartTokenHeader))
+	if !ok {
+		return
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var guestItems []models.Cart
+		if err := tx.Preload("Product").Where("guest_cart_id = ?", guestCart.ID).Find(&guestItems).Error; err != nil {
+			return err
+		}
+
+		for _, guestItem := range guestItems {
+			var userItem models.Cart
+			err := tx.Where("user_id = ? AND product_id = ?", userID, guestItem.ProductId).First(&userItem).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			quantity := fitQuantity(guestItem.Product, guestItem.Quantity+userItem.Quantity)
+
+			// Products deleted or sold out since they were added are dropped
+			if guestItem.Product.ID == 0 || quantity == 0 {
+				if err := tx.Delete(&guestItem).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			if userItem.ID == 0 {
+				err = tx.Model(&guestItem).Updates(map[string]interface{}{
+					"user_id":       userID,
+					"guest_cart_id": nil,
+					"quantity":      quantity,
+				}).Error
+			} else {
+				if err = tx.Model(&userItem).Update("quantity", quantity).Error; err == nil {
+					err = tx.Delete(&guestItem).Error
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&guestCart).Error
+	})
+	if err != nil {
+		log.Println("Failed to merge guest cart:", err)
+	}
+}
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// GuestCheckout places an order from the guest cart without an account
+// @Summary Check out as a guest
+// @Description Create an order from the guest cart with an email and shipping address. A signed lookup link for the order is emailed and returned.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param X-Cart-Token header string true "Guest cart token"
+// @Param request body dto.GuestCheckoutRequest true "Contact and shipping details"
+// @Success 201 {object} dto.GuestOrderResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.CartValidationResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /orders/guest [post]
+func GuestCheckout(c *gin.Context) {
+	var input dto.GuestCheckoutRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	guestCart, ok := findGuestCart(db.DB, c.GetHeader(cartTokenHeader))
+	if !ok {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Cart is empty"})
+		return
+	}
+
+	order := models.Order{
+		GuestEmail:      strings.TrimSpace(input.Email),
+		ShippingName:    strings.TrimSpace(input.Name),
+		ShippingAddress: strings.TrimSpace(input.Address),
+		CustomerNote:    strings.TrimSpace(input.Note),
+	}
+	if !placeOrder(c, cartOwner{GuestCartID: &guestCart.ID}, &order, nil) {
+		return
+	}
+
+	// The order is placed at this point, so a link that cannot be signed must not turn the
+	// response into an error that makes the guest order again
+	message := "Thank you for your order."
+	lookupToken, err := utils.SignLink(utils.LinkOrderLookup, order.ID, order.GuestEmail)
+	if err != nil {
+		log.Println("Failed to sign order lookup link:", err)
+	} else {
+		message += " You can check its status here:\n\n" + utils.AppURL() + "/orders/lookup?token=" + lookupToken
+	}
+	utils.Mail.Send(order.GuestEmail, "Your order has been placed", message)
+
+	c.JSON(http.StatusCreated, dto.GuestOrderResponse{
+		Order:       mapToOrderDTO(order),
+		LookupToken: lookupToken,
+	})
+}
+
+// LookupGuestOrder shows an order opened through its signed lookup link
+// @Summary Look up an order
+// @Description Retrieve the status and details of an order with the token from its lookup link
+// @Tags orders
+// @Produce json
+// @Param token path string true "Lookup token"
+// @Success 200 {object} dto.OrderLookupResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 410 {object} dto.ErrorResponse
+// @Router /orders/lookup/{token} [get]
+func LookupGuestOrder(c *gin.Context) {
+	order, ok := findOrderByLookupToken(c, c.Param("token"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.OrderLookupResponse{
+		OrderResponseDTO: mapToOrderDTO(order),
+		Email:            order.GuestEmail,
+		ShippingName:     order.ShippingName,
+		ShippingAddress:  order.ShippingAddress,
+		Claimed:          order.UserId != nil,
+	})
+}
+
+// CreateAccountFromGuestOrder turns a guest order into an account
+// @Summary Create an account from a guest order
+// @Description Create an account for the email of a guest order and attach all guest orders placed with that email. The lookup link proves ownership of the email, so it is marked verified.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param token path string true "Lookup token"
+// @Param request body dto.GuestAccountRequest true "Name and password"
+// @Success 200 {object} dto.UserLoginResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 410 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /orders/lookup/{token}/account [post]
+func CreateAccountFromGuestOrder(c *gin.Context) {
+	var input dto.GuestAccountRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	order, ok := findOrderByLookupToken(c, c.Param("token"))
+	if !ok {
+		return
+	}
+	if order.UserId != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Order not found"})
+		return
+	}
+
+	if emailTaken(db.DB, order.GuestEmail, 0) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: "An account with this email already exists, log in to claim your orders"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to hash password"})
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = order.ShippingName
+	}
+	now := time.Now()
+	user := models.User{
+		Name:            name,
+		Email:           order.GuestEmail,
+		Password:        string(hashedPassword),
+		Role:            "User",
+		EmailVerifiedAt: &now,
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		_, err := attachGuestOrders(tx, user.ID, user.Email)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create user"})
+		return
+	}
+
+	respondWithLogin(c, user, false)
+}
+
+// ClaimGuestOrders attaches guest orders to the current user's account
+// @Summary Claim guest orders
+// @Description Attach all guest orders placed with the current user's email. The lookup token of one of them proves ownership of the email.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param request body dto.ClaimGuestOrdersRequest true "Lookup token"
+// @Success 200 {object} dto.ClaimGuestOrdersResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 410 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /orders/claim [post]
+func ClaimGuestOrders(c *gin.Context) {
+	var input dto.ClaimGuestOrdersRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	order, ok := findOrderByLookupToken(c, input.Token)
+	if !ok {
+		return
+	}
+	if !strings.EqualFold(order.GuestEmail, user.Email) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "This order was placed with a different email address"})
+		return
+	}
+
+	var claimed int64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if claimed, err = attachGuestOrders(tx, user.ID, user.Email); err != nil {
+			return err
+		}
+		if user.EmailVerifiedAt == nil {
+			return tx.Model(&user).Update("email_verified_at", time.Now()).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to claim orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ClaimGuestOrdersResponse{Claimed: claimed})
+}
+
+// findOrderByLookupToken loads the order named by a lookup token if its signature is valid
+// and the link has not expired. On failure the error response is written and false is
+// returned.
+func findOrderByLookupToken(c *gin.Context, token string) (models.Order, bool) {
+	var order models.Order
+	orderID, ok := utils.LinkID(token)
+	if ok {
+		ok = db.DB.Preload("Inventory").Where("guest_email <> ''").First(&order, orderID).Error == nil
+	}
+	var issuedAt time.Time
+	if ok {
+		issuedAt, ok = utils.ValidLink(utils.LinkOrderLookup, token, order.ID, order.GuestEmail)
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Order not found"})
+		return order, false
+	}
+
+	linkLifetime := time.Duration(utils.GetEnvInt("ORDER_LOOKUP_LINK_DAYS", 90)) * 24 * time.Hour
+	if time.Since(issuedAt) > linkLifetime {
+		c.JSON(http.StatusGone, dto.ErrorResponse{Error: "This link has expired"})
+		return order, false
+	}
+	return order, true
+}
+
+// attachGuestOrders moves the guest orders placed with a verified email to the user's account
+func attachGuestOrders(tx *gorm.DB, userID uint, email string) (int64, error) {
+	result := tx.Model(&models.Order{}).
+		Where("user_id IS NULL AND LOWER(guest_email) = LOWER(?)", email).
+		Update("user_id", userID)
+	return result.RowsAffected, result.Error
+}
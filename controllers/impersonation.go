@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// impersonationNotice returns the flag added to customer views while an admin impersonates
+// the customer, or nil for the customer's own requests
+func impersonationNotice(c *gin.Context) *dto.ImpersonationNotice {
+	impersonatorID, impersonating := c.Get("impersonatorID")
+	if !impersonating {
+		return nil
+	}
+	readOnly, _ := c.Get("impersonationReadOnly")
+	return &dto.ImpersonationNotice{
+		ImpersonatedBy: impersonatorID.(uint),
+		ReadOnly:       readOnly == true,
+	}
+}
+
+// ImpersonateUser issues a token that lets support staff see what a customer sees
+// @Summary Impersonate a user
+// @Description Issue a short-lived token acting as the user. It is read-only unless writes are explicitly allowed, account and security routes such as password, email, sessions, 2FA and data requests are refused, and every request made with it is audited (admin only).
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path uint true "User ID"
+// @Param request body dto.ImpersonateRequest true "Reason and access"
+// @Success 201 {object} dto.ImpersonationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/{id}/impersonate [post]
+func ImpersonateUser(c *gin.Context) {
+	var input dto.ImpersonateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	adminID, _ := c.Get("userID")
+	adminIDUint, _ := adminID.(uint)
+
+	var target models.User
+	if err := db.DB.First(&target, targetID).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "User not found"})
+		return
+	}
+
+	// Acting as another admin would hand out admin access without their second factor
+	if target.Role == "Admin" || target.ID == adminIDUint {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "Admin accounts cannot be impersonated"})
+		return
+	}
+	if target.DeactivatedAt != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "User is deactivated"})
+		return
+	}
+
+	ttl := time.Duration(utils.GetEnvInt("IMPERSONATION_TTL_MINUTES", 15)) * time.Minute
+	readOnly := !input.AllowWrites
+
+	// The impersonation gets its own session, revoked with the user's other sessions
+	tokenID, err := utils.RandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Unable to generate token"})
+		return
+	}
+	now := time.Now()
+	session := models.Session{
+		UserId:         target.ID,
+		TokenID:        tokenID,
+		UserAgent:      c.Request.UserAgent(),
+		IP:             c.ClientIP(),
+		LastActiveAt:   now,
+		ExpiresAt:      now.Add(ttl),
+		ImpersonatorId: &adminIDUint,
+	}
+	if err := db.DB.Create(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Unable to generate token"})
+		return
+	}
+
+	token, err := utils.GenerateImpersonationJWT(target.ID, target.Role, adminIDUint, readOnly, tokenID, ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Unable to generate token"})
+		return
+	}
+
+	auditLog := models.AuditLog{
+		ActorType: "admin",
+		ActorID:   adminIDUint,
+		SubjectId: target.ID,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    http.StatusCreated,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   fmt.Sprintf("impersonation started (write access: %t): %s", input.AllowWrites, input.Reason),
+	}
+	if err := db.DB.Create(&auditLog).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to write audit log"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.ImpersonationResponse{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+		ReadOnly:  readOnly,
+		User: dto.UserRegisterResponse{
+			ID:    target.ID,
+			Name:  target.Name,
+			Email: target.Email,
+			Role:  target.Role,
+		},
+	})
+}
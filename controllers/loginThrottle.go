@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	throttleScopeAccount = "account"
+	throttleScopeIP      = "ip"
+
+	// maxLockout caps the exponential backoff applied to repeated lockouts
+	maxLockout = 24 * time.Hour
+)
+
+// dummyPasswordHash is compared against when the email is unknown so that
+// failed logins take the same time whether or not the account exists
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+
+// loginThrottleKey normalises an email so lockouts cannot be bypassed by changing its case
+func loginThrottleKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginThreshold returns the number of failures allowed before a lockout for the given scope
+func loginThreshold(scope string) uint {
+	if scope == throttleScopeIP {
+		return uint(utils.GetEnvInt("LOGIN_IP_MAX_ATTEMPTS", 50))
+	}
+	return uint(utils.GetEnvInt("LOGIN_MAX_ATTEMPTS", 5))
+}
+
+// loginLockedUntil returns the latest active lockout across the given throttles, if any
+func loginLockedUntil(email, ip string) *time.Time {
+	var throttles []models.LoginThrottle
+	db.DB.Where("(scope = ? AND identifier = ?) OR (scope = ? AND identifier = ?)",
+		throttleScopeAccount, loginThrottleKey(email), throttleScopeIP, ip).Find(&throttles)
+
+	var lockedUntil *time.Time
+	now := time.Now()
+	for _, throttle := range throttles {
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) &&
+			(lockedUntil == nil || throttle.LockedUntil.After(*lockedUntil)) {
+			lockedUntil = throttle.LockedUntil
+		}
+	}
+	return lockedUntil
+}
+
+// recordLoginFailure writes an audit record and bumps the account and IP failure counters
+func recordLoginFailure(email, ip, userAgent string, userID *uint, reason string) {
+	db.DB.Create(&models.LoginAttempt{
+		UserId:    userID,
+		Email:     loginThrottleKey(email),
+		IP:        ip,
+		UserAgent: userAgent,
+		Reason:    reason,
+	})
+
+	// Attempts made while locked are audited but do not extend the lockout
+	if reason == "locked" {
+		return
+	}
+
+	incrementLoginThrottle(throttleScopeAccount, loginThrottleKey(email))
+	incrementLoginThrottle(throttleScopeIP, ip)
+}
+
+// incrementLoginThrottle counts a failure and locks the key once it reaches its threshold.
+// Each failure beyond the threshold doubles the lockout, up to maxLockout.
+func incrementLoginThrottle(scope, identifier string) {
+	window := time.Duration(utils.GetEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 60)) * time.Minute
+	lockout := time.Duration(utils.GetEnvInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+	threshold := loginThreshold(scope)
+
+	db.DB.Transaction(func(tx *gorm.DB) error {
+		throttle := models.LoginThrottle{Scope: scope, Identifier: identifier}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&throttle).Error; err != nil {
+			return err
+		}
+
+		// Lock the row so concurrent attempts cannot lose increments
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("scope = ? AND identifier = ?", scope, identifier).First(&throttle).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if throttle.LastFailureAt != nil && now.Sub(*throttle.LastFailureAt) > window {
+			throttle.Failures = 0
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = &now
+
+		if throttle.Failures >= threshold {
+			duration := lockout
+			for i := threshold; i < throttle.Failures && duration < maxLockout; i++ {
+				duration *= 2
+			}
+			if duration > maxLockout {
+				duration = maxLockout
+			}
+			lockedUntil := now.Add(duration)
+			throttle.LockedUntil = &lockedUntil
+		}
+
+		return tx.Save(&throttle).Error
+	})
+}
+
+// resetLoginThrottle clears the failure counter for an account
+func resetLoginThrottle(email string) error {
+	return clearThrottle(throttleScopeAccount, loginThrottleKey(email))
+}
+
+// resetLoginThrottleIPs clears the lockouts of the client IPs an account failed to log in
+// from, so an unlocked user is not kept out by the lockout of their own address
+func resetLoginThrottleIPs(email string) error {
+	var ips []string
+	if err := db.DB.Model(&models.LoginAttempt{}).
+		Where("email = ?", loginThrottleKey(email)).Distinct().Pluck("ip", &ips).Error; err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if err := clearThrottle(throttleScopeIP, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearThrottle removes the failure counter and any lockout for a key
+func clearThrottle(scope, identifier string) error {
+	return db.DB.Unscoped().
+		Where("scope = ? AND identifier = ?", scope, identifier).
+		Delete(&models.LoginThrottle{}).Error
+}
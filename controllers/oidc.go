@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// oidcStateTTL bounds how long a user may take at the identity provider
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie binds a login to the browser that started it, so a callback URL with
+// someone else's state cannot log the victim in to the attacker's account
+const oidcStateCookie = "oidc_state"
+
+var (
+	errEmailNotVerified  = errors.New("email not verified by provider")
+	errPrivilegedAccount = errors.New("privileged accounts are not linked by email")
+	errAccountDeleted    = errors.New("account was deleted")
+)
+
+// OIDCLogin starts an OpenID Connect login
+// @Summary Start social login
+// @Description Redirect to the identity provider using the authorization code flow with PKCE. The state is also set in an HttpOnly cookie that the callback must present.
+// @Tags auth
+// @Param provider path string true "Provider name, e.g. google"
+// @Success 302
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Failure 502 {object} dto.ErrorResponse
+// @Router /auth/oidc/{provider}/login [get]
+func OIDCLogin(c *gin.Context) {
+	provider, err := utils.GetOIDCProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Unknown identity provider"})
+		return
+	}
+
+	state, errState := utils.RandomToken(32)
+	nonce, errNonce := utils.RandomToken(32)
+	verifier, challenge, errPKCE := utils.GeneratePKCE()
+	if errState != nil || errNonce != nil || errPKCE != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to start login"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Error: "Identity provider is unavailable"})
+		return
+	}
+
+	// Drop states of logins that were never completed
+	db.DB.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.OIDCState{})
+
+	oidcState := models.OIDCState{
+		State:        state,
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := db.DB.Create(&oidcState).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to start login"})
+		return
+	}
+
+	setOIDCStateCookie(c, state, int(oidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes an OpenID Connect login
+// @Summary Complete social login
+// @Description Exchange the authorization code, verify the ID token, link the identity to a user and return our JWT. The state must match the cookie set when the login started.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name, e.g. google"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} dto.UserLoginResponse
+// @Success 202 {object} dto.TwoFactorChallengeResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /auth/oidc/{provider}/callback [get]
+func OIDCCallback(c *gin.Context) {
+	provider, err := utils.GetOIDCProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Unknown identity provider"})
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Login was rejected by the identity provider: " + providerError})
+		return
+	}
+
+	// The state must come from the browser that started the login
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid login state"})
+		return
+	}
+
+	// Each state can only be used once
+	var oidcState models.OIDCState
+	if err := db.DB.Where("state = ? AND provider = ?", state, provider.Name).First(&oidcState).Error; err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid login state"})
+		return
+	}
+	db.DB.Unscoped().Delete(&oidcState)
+
+	if time.Now().After(oidcState.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Login has expired, please try again"})
+		return
+	}
+
+	idToken, err := provider.Exchange(c.Request.Context(), c.Query("code"), oidcState.CodeVerifier)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Failed to exchange authorization code"})
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), idToken, oidcState.Nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid ID token"})
+		return
+	}
+
+	user, err := linkOIDCIdentity(provider.Name, claims)
+	if errors.Is(err, errEmailNotVerified) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "Your email address is not verified by the identity provider"})
+		return
+	}
+	if errors.Is(err, errAccountDeleted) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "This account has been deleted"})
+		return
+	}
+	if errors.Is(err, errPrivilegedAccount) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "This account cannot use social login, please log in with your password"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to link account"})
+		return
+	}
+
+	completeLogin(c, user)
+}
+
+// setOIDCStateCookie sets or, with a negative maxAge, clears the state cookie. It is sent
+// on the top-level redirect back from the provider, but not on requests from other sites.
+func setOIDCStateCookie(c *gin.Context, state string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, "/auth/oidc", "", secure, true)
+}
+
+// linkOIDCIdentity returns the user linked to the external identity, linking it by verified
+// email or creating a new user on first login. Admin accounts are never linked by email, so
+// control of the address at the provider is not enough to gain their rights. Deleted
+// accounts are neither logged in to nor replaced by a new account with the same email.
+func linkOIDCIdentity(provider string, claims *utils.OIDCClaims) (models.User, error) {
+	var identity models.UserIdentity
+	err := db.DB.Preload("User", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+	if err == nil && identity.User.ID != 0 {
+		if identity.User.DeletedAt.Valid {
+			return models.User{}, errAccountDeleted
+		}
+		return identity.User, nil
+	}
+
+	if !claims.EmailVerified || claims.Email == "" {
+		return models.User{}, errEmailNotVerified
+	}
+
+	var user models.User
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("LOWER(email) = LOWER(?)", claims.Email).Order("deleted_at IS NOT NULL").First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// The account has no password and signs in through the provider. The user can set
+			// one through POST /users/me/password shortly after a social login.
+			name := claims.Name
+			if name == "" {
+				name = claims.Email
+			}
+			user = models.User{
+				Name:  name,
+				Email: claims.Email,
+				Role:  "User",
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else if user.DeletedAt.Valid {
+			return errAccountDeleted
+		} else if user.Role != "User" {
+			return errPrivilegedAccount
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserId:   user.ID,
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}).Error
+	})
+	return user, err
+}
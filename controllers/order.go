@@ -1,25 +1,45 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"e-commerce/db"
 	"e-commerce/dto"
 	"e-commerce/models"
+	"e-commerce/storage"
+	"e-commerce/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// orderStatusPlaced is the status of a new order
+	orderStatusPlaced     = "placed"
+	orderStatusProcessing = "processing"
+	orderStatusShipped    = "shipped"
+	orderStatusDelivered  = "delivered"
+	// orderStatusCancelled orders do not count towards purchase limits
+	orderStatusCancelled = "cancelled"
+	// orderStatusRefunded orders are counted by the refund report, not as revenue
+	orderStatusRefunded = "refunded"
 )
 
 // AddOrderFromCart creates an order from user's cart and stores it in Order and Inventory tables
 // @Summary Add an order from the cart
-// @Description Create an order from the user's cart
+// @Description Create an order from the user's cart, optionally with a coupon
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
+// @Param request body dto.CheckoutRequest false "Coupon and note for the order"
 // @Success 201 {object} dto.OrderResponseDTO
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.CartValidationResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @securityDefinitions.apiKey Authorization
 // @in header
@@ -27,23 +47,99 @@ import (
 // @Security JWT
 // @Router /orders [post]
 func AddOrderFromCart(c *gin.Context) {
+	var input dto.CheckoutRequest
+	if !bindOptionalJSON(c, &input) {
+		return
+	}
+
 	userID, _ := c.Get("userID")
 	userIDUint, _ := userID.(uint)
 
-	// Check if the user's cart has items
-	var cartItems []models.Cart
-	if err := db.DB.Where("user_id = ?", userIDUint).Preload("Product").Find(&cartItems).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch cart items"})
+	var coupon *models.Coupon
+	if input.CouponCode != "" {
+		var ok bool
+		if coupon, ok = findUsableCoupon(c, input.CouponCode, userIDUint); !ok {
+			return
+		}
+	}
+
+	order := models.Order{UserId: &userIDUint, CustomerNote: strings.TrimSpace(input.Note)}
+	if !placeOrder(c, cartOwner{UserID: &userIDUint}, &order, coupon) {
 		return
 	}
 
+	// Count the order towards abandoned cart recovery
+	markCartRecovered(userIDUint, order.ID)
+
+	c.JSON(http.StatusCreated, mapToOrderDTO(order))
+}
+
+// containsPattern builds a LIKE pattern matching values that contain the text. Wildcards
+// in the text are escaped, so they only match themselves.
+func containsPattern(text string) string {
+	return "%" + likeEscaper.Replace(text) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// bindOptionalJSON binds a JSON body that may be left out. Chunked requests have no
+// content length, so an empty body is only recognised once reading it finds nothing. On
+// failure the error response is written and false is returned.
+func bindOptionalJSON(c *gin.Context, input interface{}) bool {
+	if err := c.ShouldBindJSON(input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	return true
+}
+
+// placeOrder turns the owner's cart into the given order, takes the items out of stock and
+// empties the cart. A coupon is redeemed with the order. On failure the error response is
+// written and false is returned.
+func placeOrder(c *gin.Context, owner cartOwner, order *models.Order, coupon *models.Coupon) bool {
+	// Check if the cart has items
+	cartItems, err := fetchCheckoutItems(db.DB, owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch cart items"})
+		return false
+	}
+
 	if len(cartItems) == 0 {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Cart is empty"})
-		return
+		return false
 	}
 
-	// Calculate total bill from cart items
-	bill := calculateTotalBill(cartItems)
+	// The customer must see and accept every change before paying a different amount
+	if issues := validateCartItems(cartItems); len(issues) > 0 {
+		c.JSON(http.StatusConflict, dto.CartValidationResponse{
+			Error:  "The cart has changed, review and acknowledge the changes via /cart/validate",
+			Issues: issues,
+		})
+		return false
+	}
+
+	// Quantity rules may have changed since the items were added
+	for _, cartItem := range cartItems {
+		if qe := checkQuantity(cartItem.Product, cartItem.Quantity); qe != nil {
+			qe.respond(c)
+			return false
+		}
+	}
+
+	// Price the order with the same code path the cart view uses
+	var discounts []utils.Discount
+	if coupon != nil {
+		discounts = append(discounts, utils.PercentDiscount(coupon.Percent))
+		order.CouponId = &coupon.ID
+	}
+	pricing := utils.PriceCart(cartItems, discounts...)
+	order.Subtotal = pricing.Subtotal
+	order.Discount = pricing.Discount
+	order.Tax = pricing.Tax
+	order.Shipping = pricing.Shipping
+	order.Bill = pricing.Total
+	order.CurrentDate = time.Now()
+	order.Status = orderStatusPlaced
 
 	// Begin transaction to ensure atomicity
 	tx := db.DB.Begin()
@@ -53,64 +149,91 @@ func AddOrderFromCart(c *gin.Context) {
 		}
 	}()
 
-	// Create the order instance
-	order := models.Order{
-		UserId:      userIDUint,
-		Bill:        bill,
-		CurrentDate: time.Now(),
+	// Create the order in the database
+	if err := tx.Create(order).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create order"})
+		return false
 	}
 
-	// Create the order in the database
-	if err := tx.Create(&order).Error; err != nil {
+	if err := tx.Create(&models.OrderStatusHistory{OrderId: order.ID, Status: order.Status, ActorId: order.UserId}).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create order"})
-		return
+		return false
+	}
+
+	// A coupon can only be redeemed once, even by concurrent checkouts
+	if coupon != nil {
+		result := tx.Model(coupon).Where("used_at IS NULL").
+			Updates(map[string]interface{}{"used_at": time.Now(), "order_id": order.ID})
+		if result.Error != nil || result.RowsAffected == 0 {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: "Coupon has already been used", Code: errCodeCouponInvalid})
+			return false
+		}
 	}
 
 	// Add cart items to the inventory table with the order ID
 	for _, cartItem := range cartItems {
+		// Take the items out of stock, unless someone else bought them first
+		result := tx.Model(&models.Product{}).
+			Where("id = ? AND (stock IS NULL OR stock >= ?)", cartItem.ProductId, cartItem.Quantity).
+			Update("stock", gorm.Expr("stock - ?", cartItem.Quantity))
+		if result.Error != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to update stock"})
+			return false
+		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: "Not enough stock for " + cartItem.Product.Name, Code: errCodeInsufficientStock})
+			return false
+		}
+
+		// The stock update locks the product row, so concurrent checkouts by the same customer
+		// see each other's orders before the purchase limit is checked
+		purchased := purchasedQuantity(tx, cartItem.ProductId, order.UserId, order.GuestEmail)
+		if qe := checkPurchaseLimit(cartItem.Product, cartItem.Quantity, purchased); qe != nil {
+			tx.Rollback()
+			qe.respond(c)
+			return false
+		}
+
+		// Snapshot the product as it was sold
 		inventory := models.Inventory{
-			OrderId:  order.ID,
-			Name:     cartItem.Product.Name,
-			Price:    cartItem.Product.Price,
-			Quantity: cartItem.Quantity,
+			OrderId:     order.ID,
+			ProductId:   &cartItem.ProductId,
+			Name:        cartItem.Product.Name,
+			SKU:         cartItem.Product.SKU,
+			Description: cartItem.Product.Description,
+			Photo:       cartItem.Product.Photo,
+			PhotoKey:    cartItem.Product.PhotoKey,
+			Price:       cartItem.Product.Price,
+			Quantity:    cartItem.Quantity,
 		}
 
 		if err := tx.Create(&inventory).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to add inventory"})
-			return
+			return false
 		}
+		order.Inventory = append(order.Inventory, inventory)
 	}
 
-	// Clear user's cart after successful order creation
-	if err := tx.Where("user_id = ?", userIDUint).Delete(&models.Cart{}).Error; err != nil {
+	// Clear the cart after successful order creation
+	if err := owner.scope(tx).Where("saved_for_later = ?", false).Delete(&models.Cart{}).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to clear cart"})
-		return
+		return false
 	}
 
 	// Commit transaction
-	tx.Commit()
-
-	// Prepare the order response DTO
-	orderResponse := dto.OrderResponseDTO{
-		ID:          order.ID,
-		Bill:        order.Bill,
-		CurrentDate: order.CurrentDate,
-		Inventory:   mapToInventoryDTOs(order.Inventory),
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create order"})
+		return false
 	}
 
-	c.JSON(http.StatusCreated, orderResponse)
-}
-
-// calculateTotalBill calculates the total bill from cart items
-func calculateTotalBill(cartItems []models.Cart) float64 {
-	var total float64
-	for _, item := range cartItems {
-		total += float64(item.Quantity) * item.Product.Price
-	}
-	return total
+	return true
 }
 
 // mapToInventoryDTOs maps inventory items to inventory response DTOs
@@ -118,18 +241,39 @@ func mapToInventoryDTOs(inventoryItems []models.Inventory) []dto.InventoryRespon
 	var inventoryDTOs []dto.InventoryResponseDTO
 	for _, item := range inventoryItems {
 		inventoryDTOs = append(inventoryDTOs, dto.InventoryResponseDTO{
-			ID:       item.ID,
-			Name:     item.Name,
-			Price:    item.Price,
-			Quantity: item.Quantity,
+			ID:          item.ID,
+			ProductID:   item.ProductId,
+			Name:        item.Name,
+			SKU:         item.SKU,
+			Description: item.Description,
+			Photo:       storage.URL(item.PhotoKey, item.Photo),
+			Price:       item.Price,
+			Quantity:    item.Quantity,
 		})
 	}
 	return inventoryDTOs
 }
 
+// mapToOrderDTO maps an order with its inventory to the order response DTO
+func mapToOrderDTO(order models.Order) dto.OrderResponseDTO {
+	return dto.OrderResponseDTO{
+		ID:           order.ID,
+		Status:       order.Status,
+		Subtotal:     order.Subtotal,
+		Discount:     order.Discount,
+		CouponID:     order.CouponId,
+		Tax:          order.Tax,
+		Shipping:     order.Shipping,
+		Bill:         order.Bill,
+		CurrentDate:  order.CurrentDate,
+		CustomerNote: order.CustomerNote,
+		Inventory:    mapToInventoryDTOs(order.Inventory),
+	}
+}
+
 // GetMyOrders retrieves the user's orders
 // @Summary Get my orders
-// @Description Retrieve the current user's orders
+// @Description Retrieve the current user's orders. Each order carries an impersonation flag while an admin is acting as the user.
 // @Tags orders
 // @Accept json
 // @Produce json
@@ -151,28 +295,47 @@ func GetMyOrders(c *gin.Context) {
 		return
 	}
 
+	var orderIDs []uint
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.ID)
+	}
+	unread, err := unreadMessageCounts(orderIDs, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch orders"})
+		return
+	}
+
 	// Prepare order response DTOs
 	var orderResponses []dto.OrderResponseDTO
 	for _, order := range orders {
-		orderResponses = append(orderResponses, dto.OrderResponseDTO{
-			ID:          order.ID,
-			Bill:        order.Bill,
-			CurrentDate: order.CurrentDate,
-			Inventory:   mapToInventoryDTOs(order.Inventory),
-		})
+		orderResponse := mapToOrderDTO(order)
+		orderResponse.UnreadMessages = unread[order.ID]
+		orderResponse.Impersonation = impersonationNotice(c)
+		orderResponses = append(orderResponses, orderResponse)
 	}
 
 	c.JSON(http.StatusOK, orderResponses)
 }
 
-// GetAllOrders fetches all orders for admin role only
-// @Summary Get all orders
-// @Description Retrieve all orders (admin only)
+// GetAllOrders searches all orders for admin role only
+// @Summary Search all orders
+// @Description Retrieve a page of all orders with their customer, filtered by date, status, customer email, total and product (admin only)
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {array} dto.OrderResponseDTO
+// @Param page query int false "Page number, starting at 1"
+// @Param pageSize query int false "Orders per page, at most 100 (default 20)"
+// @Param from query string false "Placed on or after this date (YYYY-MM-DD in DB_TIMEZONE)"
+// @Param to query string false "Placed on or before this date (YYYY-MM-DD in DB_TIMEZONE)"
+// @Param status query string false "Order status"
+// @Param email query string false "Part of the customer's email"
+// @Param minTotal query number false "Smallest order total"
+// @Param maxTotal query number false "Largest order total"
+// @Param productId query uint false "Orders containing this product"
+// @Param sort query string false "date, total or status, prefixed with - for descending (default -date)"
+// @Success 200 {object} dto.AdminOrderPage
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @securityDefinitions.apiKey Authorization
 // @in header
@@ -180,22 +343,110 @@ func GetMyOrders(c *gin.Context) {
 // @Security JWT
 // @Router /orders/all [get]
 func GetAllOrders(c *gin.Context) {
+	var input dto.AdminOrderQuery
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if input.Page == 0 {
+		input.Page = 1
+	}
+	if input.PageSize == 0 {
+		input.PageSize = 20
+	}
+
+	query := db.DB.Model(&models.Order{}).Joins("LEFT JOIN users ON users.id = orders.user_id")
+	if input.From != "" {
+		from, err := parseReportDay(input.From)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid from date, expected YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("orders.created_at >= ?", from)
+	}
+	if input.To != "" {
+		to, err := parseReportDay(input.To)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid to date, expected YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("orders.created_at < ?", to.AddDate(0, 0, 1))
+	}
+	if input.Status != "" {
+		query = query.Where("orders.status = ?", input.Status)
+	}
+	if input.Email != "" {
+		query = query.Where(`LOWER(COALESCE(users.email, orders.guest_email)) LIKE ? ESCAPE '\'`, containsPattern(strings.ToLower(input.Email)))
+	}
+	if input.MinTotal != nil {
+		query = query.Where("orders.bill >= ?", *input.MinTotal)
+	}
+	if input.MaxTotal != nil {
+		query = query.Where("orders.bill <= ?", *input.MaxTotal)
+	}
+	if input.ProductID != nil {
+		query = query.Where("EXISTS (SELECT 1 FROM inventories WHERE inventories.order_id = orders.id AND inventories.product_id = ? AND inventories.deleted_at IS NULL)", *input.ProductID)
+	}
+
+	// Count and fetch from the same filters without sharing the statement
+	query = query.Session(&gorm.Session{})
+
+	response := dto.AdminOrderPage{Orders: []dto.AdminOrderResponse{}, Page: input.Page, PageSize: input.PageSize}
+	if err := query.Count(&response.Total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch orders"})
+		return
+	}
+
 	var orders []models.Order
-	if err := db.DB.Preload("User").Preload("Inventory").Find(&orders).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+	if err := query.Select("orders.*").Preload("User").Preload("Inventory").
+		Order(orderSortColumns[input.Sort]).Order("orders.id DESC").
+		Offset((input.Page - 1) * input.PageSize).Limit(input.PageSize).
+		Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch orders"})
 		return
 	}
 
-	// Prepare order response DTOs
-	var orderResponses []dto.OrderResponseDTO
+	var orderIDs []uint
 	for _, order := range orders {
-		orderResponses = append(orderResponses, dto.OrderResponseDTO{
-			ID:          order.ID,
-			Bill:        order.Bill,
-			CurrentDate: order.CurrentDate,
-			Inventory:   mapToInventoryDTOs(order.Inventory),
-		})
+		orderIDs = append(orderIDs, order.ID)
+	}
+	unread, err := unreadMessageCounts(orderIDs, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch orders"})
+		return
 	}
 
-	c.JSON(http.StatusOK, orderResponses)
+	for _, order := range orders {
+		orderResponse := mapToAdminOrderDTO(order)
+		orderResponse.UnreadMessages = unread[order.ID]
+		response.Orders = append(response.Orders, orderResponse)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// orderSortColumns maps the sort options of the admin order search to columns
+var orderSortColumns = map[string]string{
+	"":        "orders.created_at DESC",
+	"date":    "orders.created_at",
+	"-date":   "orders.created_at DESC",
+	"total":   "orders.bill",
+	"-total":  "orders.bill DESC",
+	"status":  "orders.status",
+	"-status": "orders.status DESC",
+}
+
+// mapToAdminOrderDTO maps an order with its user to the admin order response DTO
+func mapToAdminOrderDTO(order models.Order) dto.AdminOrderResponse {
+	customer := dto.OrderCustomer{
+		UserID: order.UserId,
+		Name:   order.ShippingName,
+		Email:  order.GuestEmail,
+		Guest:  order.UserId == nil,
+	}
+	if order.UserId != nil {
+		customer.Name = order.User.Name
+		customer.Email = order.User.Email
+	}
+	return dto.AdminOrderResponse{OrderResponseDTO: mapToOrderDTO(order), Customer: customer}
 }
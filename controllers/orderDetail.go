@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/middlewares"
+	"e-commerce/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetOrder retrieves one order with its line items, shipping details and status history
+// @Summary Get an order
+// @Description Retrieve an order of the current user with its line items, totals, shipping details and status history. Admins can read any order. Orders of other users are reported as not found.
+// @Tags orders
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path uint true "Order ID"
+// @Success 200 {object} dto.OrderDetailResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /orders/{id} [get]
+func GetOrder(c *gin.Context) {
+	order, ok := findAccessibleOrder(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, mapToOrderDetailDTO(order))
+}
+
+// UpdateOrderStatus changes the status of an order for admin role only
+// @Summary Update the status of an order
+// @Description Change the status of an order and add it to the status history (admin only). The note is shown to the customer. Stock is not changed.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param id path uint true "Order ID"
+// @Param request body dto.UpdateOrderStatusRequest true "New status"
+// @Success 200 {object} dto.OrderDetailResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /orders/{id}/status [put]
+func UpdateOrderStatus(c *gin.Context) {
+	var input dto.UpdateOrderStatusRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	order, ok := findAccessibleOrder(c)
+	if !ok {
+		return
+	}
+
+	var actorID *uint
+	if userID, exists := c.Get("userID"); exists {
+		if id, ok := userID.(uint); ok {
+			actorID = &id
+		}
+	}
+
+	history := models.OrderStatusHistory{OrderId: order.ID, Status: input.Status, Note: input.Note, ActorId: actorID}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&order).Update("status", input.Status).Error; err != nil {
+			return err
+		}
+		return tx.Create(&history).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to update order status"})
+		return
+	}
+	order.StatusHistory = append(order.StatusHistory, history)
+
+	c.JSON(http.StatusOK, mapToOrderDetailDTO(order))
+}
+
+// findAccessibleOrder loads the order in the id parameter when the current user owns it or
+// is an admin. Other users' orders are reported as not found, so order IDs cannot be probed.
+// On failure the error response is written and false is returned.
+func findAccessibleOrder(c *gin.Context) (models.Order, bool) {
+	var order models.Order
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Order not found"})
+		return order, false
+	}
+
+	query := db.DB.Preload("User").Preload("Inventory").
+		Preload("StatusHistory", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at, id") })
+	if !middlewares.IsAdmin(c) {
+		userID, _ := c.Get("userID")
+		userIDUint, _ := userID.(uint)
+		query = query.Where("user_id = ?", userIDUint)
+	}
+
+	if err := query.First(&order, orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Order not found"})
+		return order, false
+	}
+	return order, true
+}
+
+// mapToOrderDetailDTO maps an order with its user, inventory and status history to the
+// order detail response DTO
+func mapToOrderDetailDTO(order models.Order) dto.OrderDetailResponse {
+	detail := dto.OrderDetailResponse{
+		OrderResponseDTO: mapToOrderDTO(order),
+		Customer:         mapToAdminOrderDTO(order).Customer,
+		ShippingName:     order.ShippingName,
+		ShippingAddress:  order.ShippingAddress,
+		StatusHistory:    []dto.OrderStatusChange{},
+	}
+
+	// Orders placed before the history was kept only know their current status
+	if len(order.StatusHistory) == 0 {
+		detail.StatusHistory = append(detail.StatusHistory, dto.OrderStatusChange{Status: order.Status, CreatedAt: order.CreatedAt})
+	}
+	for _, change := range order.StatusHistory {
+		detail.StatusHistory = append(detail.StatusHistory, dto.OrderStatusChange{
+			Status:    change.Status,
+			Note:      change.Note,
+			CreatedAt: change.CreatedAt,
+		})
+	}
+	return detail
+}
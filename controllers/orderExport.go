@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is how many orders are loaded at a time while an export is streamed
+const exportBatchSize = 200
+
+// exportColumn is a column of the order export. Rows are line items with their order.
+type exportColumn struct {
+	Name  string
+	Value func(order models.Order, item models.Inventory) interface{}
+}
+
+// exportColumns are the columns of the order export in their default order
+var exportColumns = []exportColumn{
+	{"order_id", func(o models.Order, _ models.Inventory) interface{} { return o.ID }},
+	{"order_date", func(o models.Order, _ models.Inventory) interface{} { return o.CreatedAt.Format(time.RFC3339) }},
+	{"status", func(o models.Order, _ models.Inventory) interface{} { return o.Status }},
+	{"customer_id", func(o models.Order, _ models.Inventory) interface{} { return o.UserId }},
+	{"customer_email", func(o models.Order, _ models.Inventory) interface{} { return mapToAdminOrderDTO(o).Customer.Email }},
+	{"customer_name", func(o models.Order, _ models.Inventory) interface{} { return mapToAdminOrderDTO(o).Customer.Name }},
+	{"coupon_id", func(o models.Order, _ models.Inventory) interface{} { return o.CouponId }},
+	{"subtotal", func(o models.Order, _ models.Inventory) interface{} { return exportMoney(o.Subtotal) }},
+	{"discount", func(o models.Order, _ models.Inventory) interface{} { return exportMoney(o.Discount) }},
+	{"tax", func(o models.Order, _ models.Inventory) interface{} { return exportMoney(o.Tax) }},
+	{"shipping", func(o models.Order, _ models.Inventory) interface{} { return exportMoney(o.Shipping) }},
+	{"total", func(o models.Order, _ models.Inventory) interface{} { return exportMoney(o.Bill) }},
+	{"item_id", func(_ models.Order, i models.Inventory) interface{} { return nilIfZero(i.ID) }},
+	{"item_product_id", func(_ models.Order, i models.Inventory) interface{} { return i.ProductId }},
+	{"item_sku", func(_ models.Order, i models.Inventory) interface{} { return i.SKU }},
+	{"item_name", func(_ models.Order, i models.Inventory) interface{} { return i.Name }},
+	{"item_price", func(_ models.Order, i models.Inventory) interface{} { return exportMoney(i.Price) }},
+	{"item_quantity", func(_ models.Order, i models.Inventory) interface{} { return i.Quantity }},
+	{"item_total", func(_ models.Order, i models.Inventory) interface{} {
+		return exportMoney(float64(i.Quantity) * i.Price)
+	}},
+}
+
+// ExportOrders streams orders and their line items for accounting
+// @Summary Export orders
+// @Description Stream orders placed in a date range as CSV or JSON Lines with one row per line item (admin only). Money is written with two decimals in both formats. CSV text cells starting with =, +, -, @, tab or carriage return are prefixed with ' so spreadsheets do not run them as formulas.
+// @Tags orders
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security ApiKeyAuth
+// @Param format query string false "csv or ndjson (default csv)"
+// @Param from query string false "Placed on or after this date (YYYY-MM-DD in DB_TIMEZONE)"
+// @Param to query string false "Placed on or before this date (YYYY-MM-DD in DB_TIMEZONE)"
+// @Param columns query string false "Comma separated columns to include, all by default"
+// @Success 200 {string} string "Export file"
+// @Failure 400 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /orders/export [get]
+func ExportOrders(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Format must be csv or ndjson"})
+		return
+	}
+
+	columns, err := selectExportColumns(c.Query("columns"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	query := db.DB.Model(&models.Order{}).Preload("User").Preload("Inventory")
+	if value := c.Query("from"); value != "" {
+		from, err := parseReportDay(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid from date, expected YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := parseReportDay(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid to date, expected YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	var writeRow func(values []interface{}) error
+	var flush func()
+	filename := "orders_" + time.Now().Format("20060102")
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		writer := csv.NewWriter(c.Writer)
+		writeRow = func(values []interface{}) error {
+			record := make([]string, len(values))
+			for i, value := range values {
+				record[i] = exportString(value)
+			}
+			return writer.Write(record)
+		}
+		flush = writer.Flush
+
+		header := make([]interface{}, len(columns))
+		for i, column := range columns {
+			header[i] = column.Name
+		}
+		writeRow(header)
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".ndjson"))
+		encoder := json.NewEncoder(c.Writer)
+		writeRow = func(values []interface{}) error {
+			row := make(map[string]interface{}, len(values))
+			for i, value := range values {
+				row[columns[i].Name] = value
+			}
+			return encoder.Encode(row)
+		}
+		flush = func() {}
+	}
+	c.Status(http.StatusOK)
+
+	// Orders are loaded in batches so large exports do not have to fit in memory
+	var orders []models.Order
+	err = query.FindInBatches(&orders, exportBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, order := range orders {
+			items := order.Inventory
+			if len(items) == 0 {
+				items = []models.Inventory{{}}
+			}
+			for _, item := range items {
+				values := make([]interface{}, len(columns))
+				for i, column := range columns {
+					values[i] = column.Value(order, item)
+				}
+				if err := writeRow(values); err != nil {
+					return err
+				}
+			}
+		}
+		flush()
+		c.Writer.Flush()
+		return nil
+	}).Error
+	if err != nil {
+		// The status is already sent, so the export can only end early
+		log.Println("Failed to export orders:", err)
+	}
+}
+
+// selectExportColumns returns the requested export columns, or all of them
+func selectExportColumns(names string) ([]exportColumn, error) {
+	if strings.TrimSpace(names) == "" {
+		return exportColumns, nil
+	}
+
+	var columns []exportColumn
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, column := range exportColumns {
+			if column.Name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// exportMoney formats an amount with two decimals. It is written as a number in JSON and
+// as text in CSV, so both formats show the same digits.
+func exportMoney(amount float64) json.Number {
+	return json.Number(fmt.Sprintf("%.2f", amount))
+}
+
+// exportString formats an export value for CSV; missing values are empty
+func exportString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		// Customer names and product names could otherwise run as spreadsheet formulas
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	case *uint:
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(*v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// nilIfZero returns nil for the zero ID of a missing record
+func nilIfZero(id uint) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/middlewares"
+	"e-commerce/models"
+	"e-commerce/storage"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOrderMessages lists the message thread of an order
+// @Summary Get order messages
+// @Description Retrieve the messages between the customer and staff about an order and mark the other side's messages as read, except while an admin is impersonating the customer. Staff also see internal notes.
+// @Tags orders
+// @Produce json
+// @Param id path uint true "Order ID"
+// @Success 200 {array} dto.OrderMessageResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /orders/{id}/messages [get]
+func GetOrderMessages(c *gin.Context) {
+	order, ok := findAccessibleOrder(c)
+	if !ok {
+		return
+	}
+	staff := middlewares.IsAdmin(c)
+
+	query := db.DB.Where("order_id = ?", order.ID).Order("created_at, id")
+	if !staff {
+		query = query.Where("internal = ?", false)
+	}
+	var messages []models.OrderMessage
+	if err := query.Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch messages"})
+		return
+	}
+
+	// Reading the thread marks what the other side wrote as read. An admin looking at the
+	// thread as the customer has not read it for them.
+	readColumn := "read_by_customer_at"
+	if staff {
+		readColumn = "read_by_staff_at"
+	}
+	if _, impersonating := c.Get("impersonatorID"); !impersonating {
+		db.DB.Model(&models.OrderMessage{}).
+			Where("order_id = ? AND from_staff = ? AND internal = ? AND "+readColumn+" IS NULL", order.ID, !staff, false).
+			Update(readColumn, time.Now())
+	}
+
+	messageResponses := []dto.OrderMessageResponse{}
+	for _, message := range messages {
+		messageResponses = append(messageResponses, mapToOrderMessageDTO(message))
+	}
+
+	c.JSON(http.StatusOK, messageResponses)
+}
+
+// AddOrderMessage writes a message in the thread of an order
+// @Summary Send an order message
+// @Description Send a message about an order, optionally with an attachment. Staff can write internal notes that the customer does not see. The customer is emailed when staff reply.
+// @Tags orders
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path uint true "Order ID"
+// @Param body formData string false "Message, required without an attachment"
+// @Param attachment formData file false "Attachment"
+// @Param internal formData bool false "Internal staff note (staff only)"
+// @Success 201 {object} dto.OrderMessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /orders/{id}/messages [post]
+func AddOrderMessage(c *gin.Context) {
+	order, ok := findAccessibleOrder(c)
+	if !ok {
+		return
+	}
+	staff := middlewares.IsAdmin(c)
+
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+	message := models.OrderMessage{
+		OrderId:   order.ID,
+		AuthorId:  &userIDUint,
+		FromStaff: staff,
+		Body:      strings.TrimSpace(c.PostForm("body")),
+	}
+
+	if internal, _ := strconv.ParseBool(c.PostForm("internal")); internal {
+		if !staff {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Only staff can write internal notes"})
+			return
+		}
+		message.Internal = true
+	}
+
+	file, err := c.FormFile("attachment")
+	if err == nil {
+		maxSize := int64(utils.GetEnvInt("ATTACHMENT_MAX_MB", 10)) << 20
+		if file.Size > maxSize {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Attachment is too large"})
+			return
+		}
+	} else {
+		file = nil
+	}
+
+	if message.Body == "" && file == nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Message is empty"})
+		return
+	}
+	if len(message.Body) > 5000 {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Message is too long"})
+		return
+	}
+
+	if file != nil {
+		key, err := storeAttachment(c, file)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Unable to save the attachment"})
+			return
+		}
+		message.AttachmentKey = key
+		message.AttachmentName = filepath.Base(file.Filename)
+	}
+
+	if err := db.DB.Create(&message).Error; err != nil {
+		if message.AttachmentKey != "" {
+			storage.Default.Delete(c.Request.Context(), message.AttachmentKey)
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to send message"})
+		return
+	}
+
+	if staff && !message.Internal {
+		notifyCustomerOfMessage(order)
+	}
+
+	c.JSON(http.StatusCreated, mapToOrderMessageDTO(message))
+}
+
+// GetOrderMessageAttachment downloads the attachment of an order message
+// @Summary Download an order message attachment
+// @Description Download the file attached to a message of an order
+// @Tags orders
+// @Produce octet-stream
+// @Param id path uint true "Order ID"
+// @Param messageId path uint true "Message ID"
+// @Success 200 {file} file
+// @Failure 404 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /orders/{id}/messages/{messageId}/attachment [get]
+func GetOrderMessageAttachment(c *gin.Context) {
+	order, ok := findAccessibleOrder(c)
+	if !ok {
+		return
+	}
+
+	query := db.DB.Where("order_id = ? AND (attachment_key <> '' OR attachment_path <> '')", order.ID)
+	if !middlewares.IsAdmin(c) {
+		query = query.Where("internal = ?", false)
+	}
+	var message models.OrderMessage
+	if err := query.First(&message, c.Param("messageId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Attachment not found"})
+		return
+	}
+
+	// Attachments sent before the blob store are files on this instance
+	if message.AttachmentKey == "" {
+		c.FileAttachment(message.AttachmentPath, message.AttachmentName)
+		return
+	}
+
+	content, err := storage.Default.Get(c.Request.Context(), message.AttachmentKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Attachment not found"})
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, -1, "application/octet-stream", content, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": message.AttachmentName}),
+	})
+}
+
+// storeAttachment puts an uploaded attachment in the blob store under a random key. The
+// file name is only kept for display, so uploads with the same name never collide.
+func storeAttachment(c *gin.Context, file *multipart.FileHeader) (string, error) {
+	name, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	content, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	key := "attachments/" + name
+	if err := storage.Default.Put(c.Request.Context(), key, content, file.Size, "application/octet-stream"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// unreadMessageCounts counts the unread messages of each order. Customers count unread staff
+// replies, staff count unread customer messages.
+func unreadMessageCounts(orderIDs []uint, staff bool) (map[uint]int64, error) {
+	readColumn := "read_by_customer_at"
+	if staff {
+		readColumn = "read_by_staff_at"
+	}
+
+	var rows []struct {
+		OrderId uint
+		Count   int64
+	}
+	err := db.DB.Model(&models.OrderMessage{}).Select("order_id, COUNT(*) AS count").
+		Where("order_id IN ? AND from_staff = ? AND internal = ? AND "+readColumn+" IS NULL", orderIDs, !staff, false).
+		Group("order_id").Scan(&rows).Error
+
+	counts := map[uint]int64{}
+	for _, row := range rows {
+		counts[row.OrderId] = row.Count
+	}
+	return counts, err
+}
+
+// notifyCustomerOfMessage emails the customer that staff replied about their order
+func notifyCustomerOfMessage(order models.Order) {
+	email := order.GuestEmail
+	if order.UserId != nil {
+		email = order.User.Email
+	}
+	if email == "" {
+		return
+	}
+	utils.Mail.Send(email, "New message about your order",
+		"We replied to you about your order #"+strconv.FormatUint(uint64(order.ID), 10)+". You can read it here:\n\n"+
+			utils.AppURL()+"/orders/"+strconv.FormatUint(uint64(order.ID), 10))
+}
+
+// mapToOrderMessageDTO maps an order message to the order message response DTO
+func mapToOrderMessageDTO(message models.OrderMessage) dto.OrderMessageResponse {
+	readAt := message.ReadByStaffAt
+	if message.FromStaff {
+		readAt = message.ReadByCustomerAt
+	}
+	return dto.OrderMessageResponse{
+		ID:             message.ID,
+		FromStaff:      message.FromStaff,
+		Internal:       message.Internal,
+		Body:           message.Body,
+		AttachmentName: message.AttachmentName,
+		CreatedAt:      message.CreatedAt,
+		ReadAt:         readAt,
+	}
+}
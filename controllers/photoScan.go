@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// gifInfo is what scanGIF learned about a GIF without decoding its pixels
+type gifInfo struct {
+	Frames int
+	// Pixels is the number of pixels of all frames together
+	Pixels int64
+}
+
+// photoLength returns how many bytes of data the image of the format takes, by walking its
+// block structure up to the end marker. Anything after that, such as an archive appended
+// to a JPEG, is not part of the image. It returns false for truncated or malformed images.
+func photoLength(data []byte, format string) (int, bool) {
+	switch format {
+	case "jpeg":
+		return jpegLength(data)
+	case "png":
+		return pngLength(data)
+	case "gif":
+		end, _, ok := scanGIF(data)
+		return end, ok
+	}
+	return 0, false
+}
+
+// jpegLength finds the end of the EOI marker of a JPEG
+func jpegLength(data []byte) (int, bool) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, false
+	}
+	i := 2
+	for i+1 < len(data) {
+		if data[i] != 0xFF {
+			return 0, false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before a marker
+			i++
+			continue
+		case marker == 0xD9:
+			return i + 2, true
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Markers without a segment
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return 0, false
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0, false
+		}
+		i += 2 + length
+
+		// Entropy-coded data follows a scan header up to the next marker. 0xFF is escaped
+		// as 0xFF00 in it, and restart markers are part of the scan.
+		if marker == 0xDA {
+			for i+1 < len(data) && (data[i] != 0xFF || data[i+1] == 0x00 || (data[i+1] >= 0xD0 && data[i+1] <= 0xD7)) {
+				i++
+			}
+		}
+	}
+	return 0, false
+}
+
+// pngLength finds the end of the IEND chunk of a PNG
+func pngLength(data []byte) (int, bool) {
+	signature := []byte("\x89PNG\r\n\x1a\n")
+	if !bytes.HasPrefix(data, signature) {
+		return 0, false
+	}
+	i := len(signature)
+	for i+12 <= len(data) {
+		length := int64(binary.BigEndian.Uint32(data[i:]))
+		end := int64(i) + 12 + length
+		if end > int64(len(data)) {
+			return 0, false
+		}
+		if string(data[i+4:i+8]) == "IEND" {
+			return int(end), true
+		}
+		i = int(end)
+	}
+	return 0, false
+}
+
+// scanGIF walks the blocks of a GIF up to its trailer. It counts the frames and their
+// pixels, and rejects frames that reach outside the logical screen, so an animation can be
+// checked before any frame is decoded.
+func scanGIF(data []byte) (int, gifInfo, bool) {
+	var info gifInfo
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return 0, info, false
+	}
+	screenWidth := int(binary.LittleEndian.Uint16(data[6:]))
+	screenHeight := int(binary.LittleEndian.Uint16(data[8:]))
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+
+	// skipSubBlocks moves past a chain of data sub-blocks ended by an empty one
+	skipSubBlocks := func() bool {
+		for i < len(data) {
+			size := int(data[i])
+			i += 1 + size
+			if size == 0 {
+				return i <= len(data)
+			}
+		}
+		return false
+	}
+
+	for i < len(data) {
+		switch data[i] {
+		case 0x3B:
+			return i + 1, info, true
+		case 0x21:
+			// Extension: label, then its sub-blocks
+			i += 2
+			if !skipSubBlocks() {
+				return 0, info, false
+			}
+		case 0x2C:
+			if i+10 > len(data) {
+				return 0, info, false
+			}
+			left := int(binary.LittleEndian.Uint16(data[i+1:]))
+			top := int(binary.LittleEndian.Uint16(data[i+3:]))
+			width := int(binary.LittleEndian.Uint16(data[i+5:]))
+			height := int(binary.LittleEndian.Uint16(data[i+7:]))
+			if width == 0 || height == 0 || left+width > screenWidth || top+height > screenHeight {
+				return 0, info, false
+			}
+			info.Frames++
+			info.Pixels += int64(width) * int64(height)
+
+			packed := data[i+9]
+			i += 10
+			if packed&0x80 != 0 {
+				i += 3 << (packed&0x07 + 1)
+			}
+			// LZW minimum code size, then the image data sub-blocks
+			i++
+			if !skipSubBlocks() {
+				return 0, info, false
+			}
+		default:
+			return 0, info, false
+		}
+	}
+	return 0, info, false
+}
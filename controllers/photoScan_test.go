@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// zipArchive is the start of a ZIP file, as appended to an image to make a polyglot file
+var zipArchive = []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00payload")
+
+var testPalette = color.Palette{color.Black, color.White}
+
+func testJPEG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testPNG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testGIF encodes an animation of the given number of frames with a global color table
+func testGIF(t *testing.T, frames int, width int, height int) []byte {
+	t.Helper()
+	animation := &gif.GIF{Config: image.Config{ColorModel: testPalette, Width: width, Height: height}}
+	for i := 0; i < frames; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, width, height), testPalette))
+		animation.Delay = append(animation.Delay, 0)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// patchSingleFrameGIF rewrites the logical screen and the frame of a one-frame GIF from
+// testGIF. Its image descriptor directly follows the two-color global color table.
+func patchSingleFrameGIF(t *testing.T, data []byte, screenWidth, screenHeight, left, top, width, height uint16) []byte {
+	t.Helper()
+	const descriptor = 13 + 2*3
+	if data[descriptor] != 0x2C {
+		t.Fatalf("no image descriptor at offset %d", descriptor)
+	}
+	patched := append([]byte{}, data...)
+	binary.LittleEndian.PutUint16(patched[6:], screenWidth)
+	binary.LittleEndian.PutUint16(patched[8:], screenHeight)
+	for i, value := range []uint16{left, top, width, height} {
+		binary.LittleEndian.PutUint16(patched[descriptor+1+2*i:], value)
+	}
+	return patched
+}
+
+func TestPhotoLength(t *testing.T) {
+	images := map[string][]byte{
+		"jpeg": testJPEG(t, 16, 12),
+		"png":  testPNG(t, 16, 12),
+		"gif":  testGIF(t, 2, 16, 12),
+	}
+
+	for format, data := range images {
+		for _, test := range []struct {
+			name   string
+			data   []byte
+			length int
+			ok     bool
+		}{
+			{"whole image", data, len(data), true},
+			{"trailing archive", append(append([]byte{}, data...), zipArchive...), len(data), true},
+			{"trailing byte", append(append([]byte{}, data...), 0), len(data), true},
+			{"missing last byte", data[:len(data)-1], 0, false},
+			{"cut in half", data[:len(data)/2], 0, false},
+			{"signature only", data[:8], 0, false},
+			{"empty", nil, 0, false},
+			{"archive", zipArchive, 0, false},
+		} {
+			length, ok := photoLength(test.data, format)
+			if ok != test.ok || length != test.length {
+				t.Errorf("%s %s: got (%d, %t), want (%d, %t)", format, test.name, length, ok, test.length, test.ok)
+			}
+		}
+	}
+
+	if _, ok := photoLength(images["png"], "jpeg"); ok {
+		t.Error("a PNG was measured as a JPEG")
+	}
+	if _, ok := photoLength(images["jpeg"], "webp"); ok {
+		t.Error("an unknown format was measured")
+	}
+}
+
+func TestJPEGLengthSkipsEscapedMarkers(t *testing.T) {
+	// A scan whose entropy-coded data contains escaped 0xFF bytes and a restart marker
+	data := []byte{
+		0xFF, 0xD8,
+		0xFF, 0xDA, 0x00, 0x02,
+		0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56,
+		0xFF, 0xD9,
+	}
+	if length, ok := jpegLength(append(data, zipArchive...)); !ok || length != len(data) {
+		t.Errorf("got (%d, %t), want (%d, true)", length, ok, len(data))
+	}
+
+	// A segment claiming to run past the end of the file
+	if _, ok := jpegLength([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF, 0x00}); ok {
+		t.Error("a truncated segment was accepted")
+	}
+}
+
+func TestPNGLengthRejectsOversizedChunk(t *testing.T) {
+	data := testPNG(t, 4, 4)
+	// The IHDR length is the first field after the signature
+	patched := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(patched[8:], 0xFFFFFFFF)
+	if _, ok := pngLength(patched); ok {
+		t.Error("a chunk longer than the file was accepted")
+	}
+}
+
+func TestScanGIF(t *testing.T) {
+	single := testGIF(t, 1, 10, 8)
+
+	for _, test := range []struct {
+		name   string
+		data   []byte
+		frames int
+		pixels int64
+		ok     bool
+	}{
+		{"single frame", single, 1, 80, true},
+		{"animation", testGIF(t, 5, 10, 8), 5, 400, true},
+		{"frame fills the screen", patchSingleFrameGIF(t, single, 10, 8, 0, 0, 10, 8), 1, 80, true},
+		{"frame wider than the screen", patchSingleFrameGIF(t, single, 9, 8, 0, 0, 10, 8), 0, 0, false},
+		{"frame taller than the screen", patchSingleFrameGIF(t, single, 10, 7, 0, 0, 10, 8), 0, 0, false},
+		{"frame offset past the screen", patchSingleFrameGIF(t, single, 10, 8, 1, 0, 10, 8), 0, 0, false},
+		{"frame offset overflowing", patchSingleFrameGIF(t, single, 0xFFFF, 0xFFFF, 0xFFFF, 0, 10, 8), 0, 0, false},
+		{"empty frame", patchSingleFrameGIF(t, single, 10, 8, 0, 0, 0, 8), 0, 0, false},
+		// The size is read from the descriptor, the pixels are never decoded
+		{"oversized frame", patchSingleFrameGIF(t, single, 0xFFFF, 0xFFFF, 0, 0, 0xFFFF, 0xFFFF), 1, 0xFFFF * 0xFFFF, true},
+		{"missing trailer", single[:len(single)-1], 0, 0, false},
+		{"cut in half", single[:len(single)/2], 0, 0, false},
+		{"header only", single[:13], 0, 0, false},
+		{"not a GIF", testPNG(t, 10, 8), 0, 0, false},
+	} {
+		end, info, ok := scanGIF(test.data)
+		if ok != test.ok {
+			t.Errorf("%s: ok is %t, want %t", test.name, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if end != len(test.data) {
+			t.Errorf("%s: end is %d, want %d", test.name, end, len(test.data))
+		}
+		if info.Frames != test.frames || info.Pixels != test.pixels {
+			t.Errorf("%s: got %d frames and %d pixels, want %d and %d", test.name, info.Frames, info.Pixels, test.frames, test.pixels)
+		}
+	}
+
+	// Data after the trailer is not part of the GIF
+	if end, _, ok := scanGIF(append(append([]byte{}, single...), zipArchive...)); !ok || end != len(single) {
+		t.Errorf("trailing archive: got (%d, %t), want (%d, true)", end, ok, len(single))
+	}
+}
+
+func TestReencodePhotoLimits(t *testing.T) {
+	t.Setenv("PHOTO_MAX_DIMENSION", "64")
+	t.Setenv("PHOTO_MAX_FRAMES", "4")
+	t.Setenv("PHOTO_MAX_PIXELS", "1000")
+
+	for _, test := range []struct {
+		name   string
+		data   []byte
+		format string
+		code   string
+	}{
+		{"small JPEG", testJPEG(t, 16, 16), "jpeg", ""},
+		{"small PNG", testPNG(t, 16, 16), "png", ""},
+		{"small animation", testGIF(t, 3, 16, 16), "gif", ""},
+		{"JPEG too wide", testJPEG(t, 65, 8), "jpeg", errCodePhotoDimensions},
+		{"PNG too high", testPNG(t, 8, 65), "png", errCodePhotoDimensions},
+		{"JPEG with too many pixels", testJPEG(t, 40, 40), "jpeg", errCodePhotoDimensions},
+		{"too many frames", testGIF(t, 5, 4, 4), "gif", errCodePhotoDimensions},
+		{"too many pixels in all frames", testGIF(t, 4, 16, 16), "gif", errCodePhotoDimensions},
+		{"oversized GIF", patchSingleFrameGIF(t, testGIF(t, 1, 4, 4), 0xFFFF, 0xFFFF, 0, 0, 0xFFFF, 0xFFFF), "gif", errCodePhotoDimensions},
+		{"JPEG with trailing archive", append(testJPEG(t, 8, 8), zipArchive...), "jpeg", errCodePhotoInvalid},
+		{"GIF with trailing archive", append(testGIF(t, 1, 8, 8), zipArchive...), "gif", errCodePhotoInvalid},
+		{"truncated PNG", testPNG(t, 8, 8)[:40], "png", errCodePhotoInvalid},
+		{"PNG declared as JPEG", testPNG(t, 8, 8), "jpeg", errCodePhotoInvalid},
+	} {
+		cleaned, uploadErr := reencodePhoto(test.data, test.format)
+		switch {
+		case test.code == "" && uploadErr != nil:
+			t.Errorf("%s: rejected with %s", test.name, uploadErr.Code)
+		case test.code == "" && len(cleaned) == 0:
+			t.Errorf("%s: nothing was encoded", test.name)
+		case test.code != "" && uploadErr == nil:
+			t.Errorf("%s: accepted", test.name)
+		case test.code != "" && uploadErr.Code != test.code:
+			t.Errorf("%s: rejected with %s, want %s", test.name, uploadErr.Code, test.code)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+
+	"e-commerce/dto"
+	"e-commerce/storage"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes returned when an uploaded photo is rejected
+const (
+	errCodePhotoTooLarge       = "photo_too_large"
+	errCodePhotoType           = "photo_type_not_allowed"
+	errCodePhotoDimensions     = "photo_dimensions_too_large"
+	errCodePhotoInvalid        = "photo_invalid"
+	errCodePhotoStorageFailure = "photo_storage_failed"
+)
+
+// photoFormats are the accepted photo types by sniffed MIME type, with the name the image
+// package decodes them as and the file extension they are stored with
+var photoFormats = map[string]struct {
+	Format    string
+	Extension string
+}{
+	"image/jpeg": {"jpeg", ".jpg"},
+	"image/png":  {"png", ".png"},
+	"image/gif":  {"gif", ".gif"},
+}
+
+// uploadError is a rejected upload with the code clients can act on
+type uploadError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+// respond writes the upload error as the response
+func (e *uploadError) respond(c *gin.Context) {
+	c.JSON(e.Status, dto.ErrorResponse{Error: e.Message, Code: e.Code})
+}
+
+// storeProductPhoto validates an uploaded photo, re-encodes it without its metadata and
+// puts it into the blob store under a random name. The photo must be a JPEG, PNG or GIF of
+// at most PHOTO_MAX_MB megabytes and PHOTO_MAX_DIMENSION pixels wide and high.
+func storeProductPhoto(c *gin.Context, file *multipart.FileHeader) (string, *uploadError) {
+	maxSize := int64(utils.GetEnvInt("PHOTO_MAX_MB", 5)) << 20
+	tooLarge := &uploadError{http.StatusBadRequest, errCodePhotoTooLarge,
+		fmt.Sprintf("Photo must be at most %d MB", maxSize>>20)}
+	if file.Size > maxSize {
+		return "", tooLarge
+	}
+
+	content, err := file.Open()
+	if err != nil {
+		return "", &uploadError{http.StatusBadRequest, errCodePhotoInvalid, "Photo could not be read"}
+	}
+	defer content.Close()
+
+	// The declared size is not trusted, at most one byte more than allowed is read
+	data, err := io.ReadAll(io.LimitReader(content, maxSize+1))
+	if err != nil {
+		return "", &uploadError{http.StatusBadRequest, errCodePhotoInvalid, "Photo could not be read"}
+	}
+	if int64(len(data)) > maxSize {
+		return "", tooLarge
+	}
+
+	// The type is taken from the content, never from the file name or the client's header
+	contentType := http.DetectContentType(data)
+	format, allowed := photoFormats[contentType]
+	if !allowed {
+		return "", &uploadError{http.StatusBadRequest, errCodePhotoType, "Photo must be a JPEG, PNG or GIF image"}
+	}
+
+	cleaned, uploadErr := reencodePhoto(data, format.Format)
+	if uploadErr != nil {
+		return "", uploadErr
+	}
+
+	name, err := utils.RandomToken(16)
+	if err != nil {
+		return "", &uploadError{http.StatusInternalServerError, errCodePhotoStorageFailure, "Unable to save the photo"}
+	}
+	key := "products/" + name + format.Extension
+	if err := storage.Default.Put(c.Request.Context(), key, bytes.NewReader(cleaned), int64(len(cleaned)), contentType); err != nil {
+		return "", &uploadError{http.StatusInternalServerError, errCodePhotoStorageFailure, "Unable to save the photo"}
+	}
+	return key, nil
+}
+
+// deleteProductPhoto removes a stored photo that ended up unused because the product could
+// not be saved
+func deleteProductPhoto(c *gin.Context, key string) {
+	if err := storage.Default.Delete(c.Request.Context(), key); err != nil {
+		log.Printf("Failed to delete unused photo %s: %v", key, err)
+	}
+}
+
+// reencodePhoto decodes a photo and encodes it again, which drops EXIF and any other data
+// that is not part of the image. Photos that do not decode as the sniffed format, such as
+// polyglot files, are rejected. Dimensions, frames and the total pixel count are checked
+// before the pixels are decoded so small files cannot expand into huge images.
+func reencodePhoto(data []byte, format string) ([]byte, *uploadError) {
+	invalid := &uploadError{http.StatusBadRequest, errCodePhotoInvalid, "Photo is not a valid image"}
+
+	config, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decodedFormat != format {
+		return nil, invalid
+	}
+	maxDimension := utils.GetEnvInt("PHOTO_MAX_DIMENSION", 4096)
+	if config.Width > maxDimension || config.Height > maxDimension {
+		return nil, &uploadError{http.StatusBadRequest, errCodePhotoDimensions,
+			fmt.Sprintf("Photo must be at most %d×%d pixels", maxDimension, maxDimension)}
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return nil, invalid
+	}
+
+	// Data appended after the end of the image, such as a ZIP archive, makes a polyglot file
+	if length, ok := photoLength(data, format); !ok || length != len(data) {
+		return nil, invalid
+	}
+
+	// Every frame of an animation is decoded, so their number and size are limited too
+	pixels := int64(config.Width) * int64(config.Height)
+	if format == "gif" {
+		_, info, _ := scanGIF(data)
+		if info.Frames > utils.GetEnvInt("PHOTO_MAX_FRAMES", 100) {
+			return nil, &uploadError{http.StatusBadRequest, errCodePhotoDimensions,
+				fmt.Sprintf("Animated photos can have at most %d frames", utils.GetEnvInt("PHOTO_MAX_FRAMES", 100))}
+		}
+		pixels = info.Pixels
+	}
+	if maxPixels := int64(utils.GetEnvInt("PHOTO_MAX_PIXELS", 50_000_000)); pixels > maxPixels {
+		return nil, &uploadError{http.StatusBadRequest, errCodePhotoDimensions,
+			fmt.Sprintf("Photo must have at most %d pixels in all frames together", maxPixels)}
+	}
+
+	var cleaned bytes.Buffer
+	switch format {
+	case "gif":
+		// All frames are kept so animations survive
+		animation, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, invalid
+		}
+		if err := gif.EncodeAll(&cleaned, animation); err != nil {
+			return nil, invalid
+		}
+	case "png":
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, invalid
+		}
+		if err := png.Encode(&cleaned, decoded); err != nil {
+			return nil, invalid
+		}
+	default:
+		decoded, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, invalid
+		}
+		if err := jpeg.Encode(&cleaned, decoded, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, invalid
+		}
+	}
+	return cleaned.Bytes(), nil
+}
@@ -3,14 +3,14 @@ package controllers
 import (
 	"fmt"
 	"net/http"
-	"path/filepath"
-	"time"
 
 	"e-commerce/db"
 	"e-commerce/dto"
 	"e-commerce/models"
+	"e-commerce/storage"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // GetProducts fetches all products
@@ -31,6 +31,9 @@ func GetProducts(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
+	for i := range products {
+		products[i] = withPhotoURL(products[i])
+	}
 	c.JSON(http.StatusOK, products)
 }
 
@@ -41,9 +44,15 @@ func GetProducts(c *gin.Context) {
 // @Accept multipart/form-data
 // @Produce json
 // @Param name formData string true "Product Name"
+// @Param sku formData string false "Stock keeping unit"
 // @Param description formData string true "Product Description"
 // @Param price formData number true "Product Price"
-// @Param photo formData file true "Product Photo"
+// @Param photo formData file true "Product Photo, a JPEG, PNG or GIF image"
+// @Param stock formData integer false "Items in stock, omit to not track stock"
+// @Param minQuantity formData integer false "Minimum quantity per order"
+// @Param maxQuantity formData integer false "Maximum quantity per order"
+// @Param quantityStep formData integer false "Sold in multiples of this quantity"
+// @Param purchaseLimit formData integer false "Maximum quantity per customer over all orders"
 // @Success 201 {object} dto.ProductResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
@@ -62,28 +71,40 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
-	// Generate the file path
-	timestamp := time.Now().Unix()
-	filePath := filepath.Join("uploads", fmt.Sprintf("%d_%s", timestamp, filepath.Base(file.Filename)))
-
-	// Save the file to the specified path
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Unable to save the photo"})
-		return
-	}
-
 	// Bind the other product details
 	product.Name = c.PostForm("name")
+	product.SKU = c.PostForm("sku")
 	product.Description = c.PostForm("description")
 	price := c.PostForm("price")
 	fmt.Sscanf(price, "%f", &product.Price)
-	product.Photo = filePath
+
+	// Stock and quantity rules are optional
+	var rules dto.ProductStockRules
+	if err := c.ShouldBind(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	product.Stock = rules.Stock
+	applyQuantityRules(&product, rules)
+	if err := validateQuantityRules(product); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// The photo is only stored once the rest of the request is valid
+	photoKey, uploadErr := storeProductPhoto(c, file)
+	if uploadErr != nil {
+		uploadErr.respond(c)
+		return
+	}
+	product.PhotoKey = photoKey
 
 	if err := db.DB.Create(&product).Error; err != nil {
+		deleteProductPhoto(c, photoKey)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusCreated, product)
+	c.JSON(http.StatusCreated, withPhotoURL(product))
 }
 
 // UpdateProduct updates an existing product
@@ -94,9 +115,15 @@ func CreateProduct(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Product ID"
 // @Param name formData string false "Product Name"
+// @Param sku formData string false "Stock keeping unit"
 // @Param description formData string false "Product Description"
 // @Param price formData number false "Product Price"
-// @Param photo formData file false "Product Photo"
+// @Param photo formData file false "Product Photo, a JPEG, PNG or GIF image"
+// @Param stock formData integer false "Items in stock"
+// @Param minQuantity formData integer false "Minimum quantity per order"
+// @Param maxQuantity formData integer false "Maximum quantity per order"
+// @Param quantityStep formData integer false "Sold in multiples of this quantity"
+// @Param purchaseLimit formData integer false "Maximum quantity per customer over all orders"
 // @Success 200 {object} dto.ProductResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
@@ -116,21 +143,7 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	// Retrieve file from the request, if any
-	file, err := c.FormFile("photo")
-	if err == nil {
-		// Generate the file path
-		timestamp := time.Now().Unix()
-		filePath := filepath.Join("uploads", fmt.Sprintf("%d_%s", timestamp, filepath.Base(file.Filename)))
-
-		// Save the file to the specified path
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Unable to save the photo"})
-			return
-		}
-
-		product.Photo = filePath // Update photo path in the product struct
-	}
+	before := product
 
 	// Bind the other product details from form data
 	var updateData dto.ProductRequest
@@ -144,26 +157,55 @@ func UpdateProduct(c *gin.Context) {
 	if updateData.Name != "" {
 		product.Name = updateData.Name
 	}
+	if updateData.SKU != "" {
+		product.SKU = updateData.SKU
+	}
 	if updateData.Description != "" {
 		product.Description = updateData.Description
 	}
 	if updateData.Price != 0 {
 		product.Price = updateData.Price
 	}
+	if updateData.Stock != nil {
+		product.Stock = updateData.Stock
+	}
+	applyQuantityRules(&product, updateData.ProductStockRules)
+	if err := validateQuantityRules(product); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// A new photo, if any, is only stored once the rest of the request is valid
+	if file, err := c.FormFile("photo"); err == nil {
+		photoKey, uploadErr := storeProductPhoto(c, file)
+		if uploadErr != nil {
+			uploadErr.respond(c)
+			return
+		}
+
+		// Earlier photos stay in the store, order lines may still show them
+		product.PhotoKey = photoKey
+		product.Photo = ""
+	}
 
 	// Update the product in the database
 	if err := db.DB.Save(&product).Error; err != nil {
+		if product.PhotoKey != before.PhotoKey {
+			deleteProductPhoto(c, product.PhotoKey)
+		}
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	queueWishlistNotification(before, product)
+
 	// Respond with updated product details
-	c.JSON(http.StatusOK, product)
+	c.JSON(http.StatusOK, withPhotoURL(product))
 }
 
 // DeleteProduct deletes a product by ID
 // @Summary Delete a product
-// @Description Delete a product by its ID
+// @Description Delete a product by its ID. Order lines of the product keep their snapshot but no longer link to it.
 // @Tags products
 // @Produce json
 // @Param id path string true "Product ID"
@@ -185,8 +227,15 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	// Delete the product
-	if err := db.DB.Delete(&product).Error; err != nil {
+	// Products are soft-deleted, so the foreign key never clears the order lines and they are
+	// unlinked here. The lines keep their snapshot of the product.
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Inventory{}).Where("product_id = ?", product.ID).Update("product_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&product).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
@@ -217,5 +266,27 @@ func GetProductByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, product)
+	c.JSON(http.StatusOK, withPhotoURL(product))
+}
+
+// applyQuantityRules sets the quantity rules that were given in the request
+func applyQuantityRules(product *models.Product, input dto.ProductStockRules) {
+	if input.MinQuantity != nil {
+		product.MinQuantity = *input.MinQuantity
+	}
+	if input.MaxQuantity != nil {
+		product.MaxQuantity = *input.MaxQuantity
+	}
+	if input.QuantityStep != nil {
+		product.QuantityStep = *input.QuantityStep
+	}
+	if input.PurchaseLimit != nil {
+		product.PurchaseLimit = *input.PurchaseLimit
+	}
+}
+
+// withPhotoURL sets the photo of a product to the URL it can be downloaded from
+func withPhotoURL(product models.Product) models.Product {
+	product.Photo = storage.URL(product.PhotoKey, product.Photo)
+	return product
 }
@@ -0,0 +1,375 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// emailVerificationTTL is how long a link sent to a new email address stays valid
+const emailVerificationTTL = 24 * time.Hour
+
+// errCodeReauthenticationRequired asks accounts without a password to log in again through
+// their social login provider before a sensitive action
+const errCodeReauthenticationRequired = "reauthentication_required"
+
+// GetProfile returns the current user's profile
+// @Summary Get my profile
+// @Description Retrieve the profile of the current user
+// @Tags users
+// @Produce json
+// @Success 200 {object} dto.UserProfileResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me [get]
+func GetProfile(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, mapToUserProfileDTO(user))
+}
+
+// UpdateProfile updates the current user's profile
+// @Summary Update my profile
+// @Description Update the name of the current user. The email is changed through /users/me/email.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param profile body dto.UpdateProfileRequest true "Profile"
+// @Success 200 {object} dto.UserProfileResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me [patch]
+func UpdateProfile(c *gin.Context) {
+	var input dto.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	user.Name = strings.TrimSpace(input.Name)
+	if user.Name == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Name cannot be empty"})
+		return
+	}
+
+	if err := db.DB.Model(&user).Update("name", user.Name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapToUserProfileDTO(user))
+}
+
+// ChangePassword changes the current user's password
+// @Summary Change my password
+// @Description Change the password of the current user after verifying the current one. Accounts created through social login set their first password with a login from the last REAUTH_MINUTES instead.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/password [post]
+func ChangePassword(c *gin.Context) {
+	var input dto.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !confirmIdentity(c, user, input.CurrentPassword, "Current password is incorrect") {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to hash password"})
+		return
+	}
+
+	// Log out every other device, which may be where the old password leaked
+	currentSessionID, _ := c.Get("sessionID")
+	currentSessionIDUint, _ := currentSessionID.(uint)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID, currentSessionIDUint)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to change password"})
+		return
+	}
+
+	utils.Mail.Send(user.Email, "Your password was changed",
+		"The password of your account was just changed. If this was not you, please contact support.")
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Password changed"})
+}
+
+// ChangeEmail starts changing the current user's email address
+// @Summary Change my email
+// @Description Send a verification link to the new address. The email changes once the link is confirmed. Accounts created through social login, which have no password, confirm with a login from the last REAUTH_MINUTES instead.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.ChangeEmailRequest true "New email and password"
+// @Success 202 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/email [post]
+func ChangeEmail(c *gin.Context) {
+	var input dto.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !confirmIdentity(c, user, input.Password, "Invalid credentials") {
+		return
+	}
+
+	newEmail := strings.TrimSpace(input.NewEmail)
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "This is already your email address"})
+		return
+	}
+
+	if emailTaken(db.DB, newEmail, user.ID) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: "Email is already in use"})
+		return
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create verification"})
+		return
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the latest requested address can be confirmed
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.EmailVerification{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.EmailVerification{
+			UserId:    user.ID,
+			Email:     newEmail,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(emailVerificationTTL),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("pending_email", newEmail).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create verification"})
+		return
+	}
+
+	if err := utils.Mail.Send(newEmail, "Confirm your new email address",
+		"Open this link to confirm your new email address:\n\n"+utils.AppURL()+"/verify-email?token="+token); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to send verification email"})
+		return
+	}
+	utils.Mail.Send(user.Email, "Email change requested",
+		"A change of your account email to "+newEmail+" was requested. If this was not you, please change your password.")
+
+	c.JSON(http.StatusAccepted, dto.SuccessResponse{Message: "Verification email sent to the new address"})
+}
+
+// VerifyEmail confirms an email address from a verification link
+// @Summary Verify email
+// @Description Confirm an email address with the token from the verification link
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/verify-email [post]
+func VerifyEmail(c *gin.Context) {
+	var input dto.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var verification models.EmailVerification
+	if err := db.DB.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(input.Token), time.Now()).
+		First(&verification).Error; err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid or expired verification link"})
+		return
+	}
+
+	if emailTaken(db.DB, verification.Email, verification.UserId) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: "Email is already in use"})
+		return
+	}
+
+	now := time.Now()
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&verification).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", verification.UserId).Updates(map[string]interface{}{
+			"email":             verification.Email,
+			"pending_email":     "",
+			"email_verified_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		// Orders placed as a guest with the verified address now belong to the account
+		_, err := attachGuestOrders(tx, verification.UserId, verification.Email)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Email verified"})
+}
+
+// DeactivateAccount deactivates the current user's account
+// @Summary Deactivate my account
+// @Description Deactivate the current user's account. Existing tokens stop working and login is refused. Accounts created through social login, which have no password, confirm with a login from the last REAUTH_MINUTES instead.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.PasswordConfirmationRequest true "Password"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/deactivate [post]
+func DeactivateAccount(c *gin.Context) {
+	var input dto.PasswordConfirmationRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !confirmIdentity(c, user, input.Password, "Invalid credentials") {
+		return
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("deactivated_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID, 0)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to deactivate account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Account deactivated"})
+}
+
+// confirmIdentity checks that the request really comes from the user before a sensitive
+// action. Users with a password confirm with it. Accounts created through social login have
+// none, so their session must have been started within REAUTH_MINUTES instead. On failure
+// the error response is written and false is returned.
+func confirmIdentity(c *gin.Context, user models.User, password string, wrongPassword string) bool {
+	if user.Password != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: wrongPassword})
+			return false
+		}
+		return true
+	}
+
+	sessionID, _ := c.Get("sessionID")
+	freshSince := time.Now().Add(-time.Duration(utils.GetEnvInt("REAUTH_MINUTES", 10)) * time.Minute)
+	var fresh int64
+	db.DB.Model(&models.Session{}).Where("id = ? AND user_id = ? AND created_at > ?", sessionID, user.ID, freshSince).Count(&fresh)
+	if fresh == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "Log in again with your social login provider to confirm this action",
+			Code:  errCodeReauthenticationRequired,
+		})
+		return false
+	}
+	return true
+}
+
+// emailTaken reports whether another user already uses the email address
+func emailTaken(tx *gorm.DB, email string, exceptUserID uint) bool {
+	var count int64
+	tx.Model(&models.User{}).Where("LOWER(email) = LOWER(?) AND id <> ?", email, exceptUserID).Count(&count)
+	return count > 0
+}
+
+// mapToUserProfileDTO maps a user to the profile response DTO
+func mapToUserProfileDTO(user models.User) dto.UserProfileResponse {
+	return dto.UserProfileResponse{
+		ID:               user.ID,
+		Name:             user.Name,
+		Email:            user.Email,
+		Role:             user.Role,
+		PendingEmail:     user.PendingEmail,
+		EmailVerified:    user.EmailVerifiedAt != nil,
+		TwoFactorEnabled: user.TotpEnabled,
+		HasPassword:      user.Password != "",
+		CreatedAt:        user.CreatedAt,
+	}
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Error codes returned when a cart quantity breaks a product's rules
+const (
+	errCodeQuantityBelowMinimum = "quantity_below_minimum"
+	errCodeQuantityAboveMaximum = "quantity_above_maximum"
+	errCodeQuantityStep         = "quantity_step"
+	errCodePurchaseLimit        = "purchase_limit_exceeded"
+	errCodeInsufficientStock    = "insufficient_stock"
+)
+
+// quantityError is a broken quantity rule with the code clients can act on
+type quantityError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+// respond writes the quantity error as the response
+func (e *quantityError) respond(c *gin.Context) {
+	c.JSON(e.Status, dto.ErrorResponse{Error: e.Message, Code: e.Code})
+}
+
+// maxQuantity is the largest quantity of a product one cart line can hold. Products without
+// their own maximum are capped at CART_MAX_QUANTITY.
+func maxQuantity(product models.Product) uint {
+	if product.MaxQuantity > 0 {
+		return product.MaxQuantity
+	}
+	return uint(utils.GetEnvInt("CART_MAX_QUANTITY", 999))
+}
+
+// smallestQuantity is the smallest quantity of a product that can be put in the cart
+func smallestQuantity(product models.Product) uint {
+	quantity := product.MinQuantity
+	if quantity == 0 {
+		quantity = 1
+	}
+	if product.QuantityStep > 1 && quantity%product.QuantityStep != 0 {
+		quantity += product.QuantityStep - quantity%product.QuantityStep
+	}
+	return quantity
+}
+
+// checkQuantity checks a cart line quantity against the product's quantity rules and stock
+func checkQuantity(product models.Product, quantity uint) *quantityError {
+	switch {
+	case quantity < product.MinQuantity:
+		return &quantityError{http.StatusBadRequest, errCodeQuantityBelowMinimum,
+			fmt.Sprintf("At least %d of %s must be ordered", product.MinQuantity, product.Name)}
+	case quantity > maxQuantity(product):
+		return &quantityError{http.StatusBadRequest, errCodeQuantityAboveMaximum,
+			fmt.Sprintf("At most %d of %s can be ordered", maxQuantity(product), product.Name)}
+	case product.QuantityStep > 1 && quantity%product.QuantityStep != 0:
+		return &quantityError{http.StatusBadRequest, errCodeQuantityStep,
+			fmt.Sprintf("%s is sold in multiples of %d", product.Name, product.QuantityStep)}
+	case exceedsStock(product, quantity):
+		return &quantityError{http.StatusConflict, errCodeInsufficientStock, stockError(product)}
+	}
+	return nil
+}
+
+// validateQuantityRules checks that a product's quantity rules leave a quantity that can be ordered
+func validateQuantityRules(product models.Product) error {
+	if product.MaxQuantity > 0 && product.MinQuantity > product.MaxQuantity {
+		return fmt.Errorf("minQuantity %d is larger than maxQuantity %d", product.MinQuantity, product.MaxQuantity)
+	}
+	if product.QuantityStep > 1 && product.MinQuantity%product.QuantityStep != 0 {
+		return fmt.Errorf("minQuantity %d is not a multiple of quantityStep %d", product.MinQuantity, product.QuantityStep)
+	}
+	return nil
+}
+
+// checkPurchaseLimit checks a quantity plus what the customer ordered before against the
+// product's per-customer purchase limit
+func checkPurchaseLimit(product models.Product, quantity uint, purchased uint) *quantityError {
+	if product.PurchaseLimit == 0 || purchased+quantity <= product.PurchaseLimit {
+		return nil
+	}
+	remaining := uint(0)
+	if purchased < product.PurchaseLimit {
+		remaining = product.PurchaseLimit - purchased
+	}
+	return &quantityError{http.StatusConflict, errCodePurchaseLimit,
+		fmt.Sprintf("%s is limited to %d per customer, you can order %d more", product.Name, product.PurchaseLimit, remaining)}
+}
+
+// purchasedQuantity sums how many of a product a customer ordered before. Customers are
+// identified by their user ID or, for guest checkout, by email.
+func purchasedQuantity(tx *gorm.DB, productID uint, userID *uint, email string) uint {
+	query := tx.Table("inventories").
+		Joins("JOIN orders ON orders.id = inventories.order_id AND orders.deleted_at IS NULL").
+		Where("inventories.product_id = ? AND inventories.deleted_at IS NULL AND orders.status <> ?", productID, orderStatusCancelled)
+	if userID != nil {
+		query = query.Where("orders.user_id = ?", *userID)
+	} else {
+		query = query.Where("LOWER(orders.guest_email) = LOWER(?)", email)
+	}
+
+	var purchased uint
+	query.Select("COALESCE(SUM(inventories.quantity), 0)").Scan(&purchased)
+	return purchased
+}
+
+// fitQuantity reduces a quantity to the largest one the product's rules and stock allow,
+// or 0 if none is left
+func fitQuantity(product models.Product, quantity uint) uint {
+	if quantity > maxQuantity(product) {
+		quantity = maxQuantity(product)
+	}
+	if product.Stock != nil && quantity > *product.Stock {
+		quantity = *product.Stock
+	}
+	if product.QuantityStep > 1 {
+		quantity -= quantity % product.QuantityStep
+	}
+	if quantity < product.MinQuantity {
+		return 0
+	}
+	return quantity
+}
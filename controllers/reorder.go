@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReorderOrder adds the lines of a past order to the cart
+// @Summary Buy an order again
+// @Description Add the items of one of the user's past orders to the cart at current prices. Items that are no longer sold are skipped, quantities are reduced to what the quantity rules, stock and purchase limit allow (reported as quantity_reduced or purchase_limit_exceeded), and price changes since the order are reported. Lines already in the cart keep the price they were added at, and a line saved for later is moved back into the cart with the ordered quantity (reported as moved_from_saved_for_later).
+// @Tags orders
+// @Produce json
+// @Param id path uint true "Order ID"
+// @Success 200 {object} dto.ReorderResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /orders/{id}/reorder [post]
+func ReorderOrder(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid order ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	var order models.Order
+	if err := db.DB.Preload("Inventory").Where("id = ? AND user_id = ?", orderID, userIDUint).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Order not found"})
+		return
+	}
+
+	response := dto.ReorderResponse{Added: []dto.ReorderItem{}, Issues: []dto.CartIssue{}}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, line := range order.Inventory {
+			product, found, err := findReorderProduct(tx, line)
+			if err != nil {
+				return err
+			}
+			if !found {
+				response.Issues = append(response.Issues, dto.CartIssue{
+					Name:    line.Name,
+					Type:    cartIssueProductUnavailable,
+					Message: fmt.Sprintf("%s is no longer available", line.Name),
+				})
+				continue
+			}
+
+			var cartItem models.Cart
+			err = tx.Where("user_id = ? AND product_id = ?", userIDUint, product.ID).First(&cartItem).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			inCart := cartItem.Quantity
+			if cartItem.SavedForLater {
+				inCart = 0
+			}
+
+			// Add what the quantity rules, stock and purchase limit still allow
+			quantity := fitQuantity(product, inCart+line.Quantity)
+			limited := false
+			if product.PurchaseLimit > 0 {
+				purchased := purchasedQuantity(tx, product.ID, &userIDUint, "")
+				if purchased >= product.PurchaseLimit {
+					quantity, limited = 0, true
+				} else if quantity > product.PurchaseLimit-purchased {
+					quantity, limited = fitQuantity(product, product.PurchaseLimit-purchased), true
+				}
+			}
+
+			// The product is still sold, so a shortfall is a reduced quantity or the purchase limit
+			shortfallType := cartIssueQuantityReduced
+			if limited {
+				shortfallType = cartIssuePurchaseLimit
+			}
+
+			issue := dto.CartIssue{CartItemID: cartItem.ID, ProductID: product.ID, Name: product.Name}
+			if quantity <= inCart {
+				issue.Type = shortfallType
+				issue.Message = fmt.Sprintf("No more of %s can be added to the cart", product.Name)
+				if limited {
+					issue.Message = fmt.Sprintf("%s is limited to %d per customer", product.Name, product.PurchaseLimit)
+				}
+				response.Issues = append(response.Issues, issue)
+				continue
+			}
+			added := quantity - inCart
+			movedFromSaved := cartItem.SavedForLater
+			savedQuantity := cartItem.Quantity
+
+			// A line already in the cart keeps the price it was added at, so a price change
+			// since then is still reported when the cart is validated
+			if cartItem.ID == 0 {
+				cartItem.PriceAtAdd = product.Price
+			}
+			cartItem.UserId = &userIDUint
+			cartItem.ProductId = product.ID
+			cartItem.Quantity = quantity
+			cartItem.SavedForLater = false
+			if err := tx.Save(&cartItem).Error; err != nil {
+				return err
+			}
+			issue.CartItemID = cartItem.ID
+
+			response.Added = append(response.Added, dto.ReorderItem{
+				CartItemID: cartItem.ID,
+				ProductID:  product.ID,
+				Name:       product.Name,
+				Quantity:   added,
+				Price:      product.Price,
+			})
+
+			if movedFromSaved {
+				moved := issue
+				moved.Type = cartIssueMovedFromSaved
+				moved.Message = fmt.Sprintf("%s was saved for later with a quantity of %d and is back in the cart with %d", product.Name, savedQuantity, quantity)
+				response.Issues = append(response.Issues, moved)
+			}
+			if added < line.Quantity {
+				reduced := issue
+				reduced.Type = shortfallType
+				reduced.Message = fmt.Sprintf("Only %d of the %d %s ordered could be added", added, line.Quantity, product.Name)
+				response.Issues = append(response.Issues, reduced)
+			}
+			if product.Price != line.Price {
+				issue.Type = cartIssuePriceChanged
+				issue.PreviousPrice = line.Price
+				issue.CurrentPrice = product.Price
+				issue.Message = fmt.Sprintf("The price of %s changed from %.2f to %.2f", product.Name, line.Price, product.Price)
+				response.Issues = append(response.Issues, issue)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to add items to cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// findReorderProduct finds the product an order line was for. Lines of older orders have no
+// product ID and are matched by their snapshotted name.
+func findReorderProduct(tx *gorm.DB, line models.Inventory) (models.Product, bool, error) {
+	var product models.Product
+	query := tx.Where("name = ?", line.Name).Order("id DESC")
+	if line.ProductId != nil {
+		query = tx.Where("id = ?", *line.ProductId)
+	}
+	err := query.First(&product).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return product, false, nil
+	}
+	return product, err == nil, err
+}
@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetSalesReport reports revenue and order counts per day, week or month
+// @Summary Sales report
+// @Description Revenue, order count and average order value per day, week or month in the DB_TIMEZONE time zone. Cancelled and refunded orders are not counted. Defaults to the last 30 days.
+// @Tags reports
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Param interval query string false "day, week or month (default day)"
+// @Success 200 {object} dto.SalesReport
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /reports/sales [get]
+func GetSalesReport(c *gin.Context) {
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+	interval := c.DefaultQuery("interval", "day")
+	if interval != "day" && interval != "week" && interval != "month" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Interval must be day, week or month"})
+		return
+	}
+
+	report := dto.SalesReport{From: from, To: to, Interval: interval, Timezone: reportTimezone().String(), Periods: []dto.SalesPeriod{}}
+	err := salesOrders(from, to).
+		Select("to_char(date_trunc(?, orders.created_at AT TIME ZONE ?), 'YYYY-MM-DD') AS period, "+
+			"COUNT(*) AS orders, SUM(orders.bill) AS revenue, AVG(orders.bill) AS average_order_value",
+			interval, reportTimezone().String()).
+		Group("1").Order("1").Scan(&report.Periods).Error
+	if err == nil {
+		var totals dto.SalesPeriod
+		err = salesOrders(from, to).
+			Select("COUNT(*) AS orders, COALESCE(SUM(orders.bill), 0) AS revenue, COALESCE(AVG(orders.bill), 0) AS average_order_value").
+			Scan(&totals).Error
+		report.Orders = totals.Orders
+		report.Revenue = roundReportMoney(totals.Revenue)
+		report.AverageOrderValue = roundReportMoney(totals.AverageOrderValue)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to build report"})
+		return
+	}
+
+	for i := range report.Periods {
+		report.Periods[i].Revenue = roundReportMoney(report.Periods[i].Revenue)
+		report.Periods[i].AverageOrderValue = roundReportMoney(report.Periods[i].AverageOrderValue)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetTopProductsReport reports the best selling products
+// @Summary Top products report
+// @Description The products sold most by quantity or revenue. Cancelled and refunded orders are not counted. Defaults to the last 30 days.
+// @Tags reports
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Param by query string false "quantity or revenue (default quantity)"
+// @Param limit query int false "Number of products, at most 100 (default 10)"
+// @Success 200 {object} dto.TopProductsReport
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /reports/top-products [get]
+func GetTopProductsReport(c *gin.Context) {
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+	by := c.DefaultQuery("by", "quantity")
+	if by != "quantity" && by != "revenue" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "By must be quantity or revenue"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Limit must be between 1 and 100"})
+		return
+	}
+
+	report := dto.TopProductsReport{From: from, To: to, By: by, Products: []dto.TopProduct{}}
+
+	// Lines of unknown products are grouped by the name they were sold under
+	err = salesOrders(from, to).
+		Joins("JOIN inventories ON inventories.order_id = orders.id AND inventories.deleted_at IS NULL").
+		Select("inventories.product_id, MAX(inventories.name) AS name, SUM(inventories.quantity) AS quantity, " +
+			"SUM(inventories.quantity * inventories.price) AS revenue").
+		Group("inventories.product_id, CASE WHEN inventories.product_id IS NULL THEN inventories.name END").
+		Order(by + " DESC").Limit(limit).Scan(&report.Products).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to build report"})
+		return
+	}
+
+	for i := range report.Products {
+		report.Products[i].Revenue = roundReportMoney(report.Products[i].Revenue)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetCustomerReport reports new and returning customers
+// @Summary New vs returning customers report
+// @Description Customers who ordered in the period, split by whether it was their first order. Guests are told apart by email. Defaults to the last 30 days.
+// @Tags reports
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} dto.CustomerReport
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /reports/customers [get]
+func GetCustomerReport(c *gin.Context) {
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+
+	var report dto.CustomerReport
+	err := db.DB.Raw(`WITH customer_orders AS (
+			SELECT COALESCE(user_id::text, LOWER(guest_email)) AS customer, created_at, bill
+			FROM orders
+			WHERE deleted_at IS NULL AND status NOT IN (?, ?)
+		), first_orders AS (
+			SELECT customer, MIN(created_at) AS first_order FROM customer_orders GROUP BY customer
+		)
+		SELECT
+			COUNT(DISTINCT o.customer) AS customers,
+			COUNT(DISTINCT o.customer) FILTER (WHERE f.first_order >= ?) AS new_customers,
+			COUNT(DISTINCT o.customer) FILTER (WHERE f.first_order < ?) AS returning_customers,
+			COALESCE(SUM(o.bill) FILTER (WHERE f.first_order >= ?), 0) AS new_revenue,
+			COALESCE(SUM(o.bill) FILTER (WHERE f.first_order < ?), 0) AS returning_revenue
+		FROM customer_orders o JOIN first_orders f ON f.customer = o.customer
+		WHERE o.created_at >= ? AND o.created_at < ?`,
+		orderStatusCancelled, orderStatusRefunded, from, from, from, from, from, to).
+		Scan(&report).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to build report"})
+		return
+	}
+
+	report.From, report.To = from, to
+	report.NewRevenue = roundReportMoney(report.NewRevenue)
+	report.ReturningRevenue = roundReportMoney(report.ReturningRevenue)
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetRefundReport reports how many orders were refunded
+// @Summary Refund report
+// @Description Share of the orders placed in the period that were refunded. Cancelled orders are not counted. Defaults to the last 30 days.
+// @Tags reports
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} dto.RefundReport
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /reports/refunds [get]
+func GetRefundReport(c *gin.Context) {
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+
+	var report dto.RefundReport
+	err := db.DB.Model(&models.Order{}).
+		Select("COUNT(*) AS orders, COUNT(*) FILTER (WHERE status = ?) AS refunded_orders, "+
+			"COALESCE(SUM(bill) FILTER (WHERE status = ?), 0) AS refunded_revenue", orderStatusRefunded, orderStatusRefunded).
+		Where("created_at >= ? AND created_at < ? AND status <> ?", from, to, orderStatusCancelled).
+		Scan(&report).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to build report"})
+		return
+	}
+
+	report.From, report.To = from, to
+	if report.Orders > 0 {
+		report.RefundRate = float64(report.RefundedOrders) / float64(report.Orders)
+	}
+	report.RefundedRevenue = roundReportMoney(report.RefundedRevenue)
+
+	c.JSON(http.StatusOK, report)
+}
+
+// reportTimezone is the time zone report dates are read and grouped in
+func reportTimezone() *time.Location {
+	if location, err := time.LoadLocation(os.Getenv("DB_TIMEZONE")); err == nil {
+		return location
+	}
+	return time.UTC
+}
+
+// parseReportRange reads the from and to dates of a report in the report time zone. To is
+// inclusive, so the returned end is the start of the following day. The range defaults to
+// the last 30 days. On failure the error response is written and false is returned.
+func parseReportRange(c *gin.Context) (time.Time, time.Time, bool) {
+	location := reportTimezone()
+	now := time.Now().In(location)
+	to := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+	if value := c.Query("to"); value != "" {
+		day, err := parseReportDay(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid to date, expected YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		day, err := parseReportDay(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid from date, expected YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = day
+	}
+
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "From must not be after to"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// parseReportDay reads a YYYY-MM-DD date as the start of that day in the report time zone
+func parseReportDay(value string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", value, reportTimezone())
+}
+
+// salesOrders selects the orders that count as sales in a date range
+func salesOrders(from, to time.Time) *gorm.DB {
+	return db.DB.Model(&models.Order{}).
+		Where("orders.created_at >= ? AND orders.created_at < ? AND orders.status NOT IN (?, ?)",
+			from, to, orderStatusCancelled, orderStatusRefunded)
+}
+
+// roundReportMoney rounds an aggregated amount to cents
+func roundReportMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetSessions lists the devices the current user is logged in on
+// @Summary Get my sessions
+// @Description Retrieve the active sessions of the current user with device, IP and last activity. Impersonations by support staff are not listed.
+// @Tags users
+// @Produce json
+// @Success 200 {array} dto.SessionResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/sessions [get]
+func GetSessions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+	currentSessionID, _ := c.Get("sessionID")
+
+	var sessions []models.Session
+	if err := db.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ? AND impersonator_id IS NULL", userIDUint, time.Now()).
+		Order("last_active_at DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch sessions"})
+		return
+	}
+
+	var sessionResponses []dto.SessionResponse
+	for _, session := range sessions {
+		sessionResponses = append(sessionResponses, dto.SessionResponse{
+			ID:           session.ID,
+			UserAgent:    session.UserAgent,
+			IP:           session.IP,
+			CreatedAt:    session.CreatedAt,
+			LastActiveAt: session.LastActiveAt,
+			ExpiresAt:    session.ExpiresAt,
+			Current:      currentSessionID == session.ID,
+		})
+	}
+
+	c.JSON(http.StatusOK, sessionResponses)
+}
+
+// RevokeSession logs the current user out of one session
+// @Summary Revoke a session
+// @Description Revoke one of the current user's sessions; its token stops working immediately
+// @Tags users
+// @Produce json
+// @Param id path uint true "Session ID"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/sessions/{id} [delete]
+func RevokeSession(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid session ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	result := db.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userIDUint).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to revoke session"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Session revoked"})
+}
+
+// RevokeOtherSessions logs the current user out everywhere except the current session
+// @Summary Revoke all other sessions
+// @Description Revoke every session of the current user except the one making the request
+// @Tags users
+// @Produce json
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/me/sessions/revoke-others [post]
+func RevokeOtherSessions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+	currentSessionID, _ := c.Get("sessionID")
+	currentSessionIDUint, _ := currentSessionID.(uint)
+
+	// Support staff acting as the user must not log the user out of their own devices
+	if _, impersonating := c.Get("impersonatorID"); impersonating || currentSessionIDUint == 0 {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "Sessions can only be revoked by the user"})
+		return
+	}
+
+	if err := revokeUserSessions(db.DB, userIDUint, currentSessionIDUint); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "All other sessions revoked"})
+}
+
+// errImpersonationSession refuses to start a session for the user from a request made by
+// support staff acting as the user
+var errImpersonationSession = errors.New("sessions cannot be issued while impersonating")
+
+// issueSessionToken records a new session for the request's device and returns its token.
+// Impersonation requests never get one, it would outlive the impersonation and carry no actor.
+func issueSessionToken(c *gin.Context, user models.User, mfa bool) (string, error) {
+	if _, impersonating := c.Get("impersonatorID"); impersonating {
+		return "", errImpersonationSession
+	}
+
+	tokenID, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserId:       user.ID,
+		TokenID:      tokenID,
+		UserAgent:    c.Request.UserAgent(),
+		IP:           c.ClientIP(),
+		LastActiveAt: now,
+		ExpiresAt:    now.Add(utils.SessionTTL),
+	}
+	if err := db.DB.Create(&session).Error; err != nil {
+		return "", err
+	}
+
+	return utils.GenerateJWT(user.ID, user.Role, mfa, tokenID)
+}
+
+// revokeUserSessions revokes all active sessions of a user except the given one
+func revokeUserSessions(tx *gorm.DB, userID uint, exceptSessionID uint) error {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptSessionID).
+		Update("revoked_at", time.Now()).Error
+}
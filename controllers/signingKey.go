@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"net/http"
+
+	"e-commerce/dto"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publishes the public keys that verify our tokens
+// @Summary Get JSON Web Key Set
+// @Description Retrieve the public keys used to verify JWTs issued by this service
+// @Tags auth
+// @Produce json
+// @Success 200 {object} dto.JWKSResponse
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+	// Let verifiers cache the set, but not for so long that they miss a rotation
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, dto.JWKSResponse{Keys: utils.JWKS()})
+}
+
+// RotateSigningKey replaces the active JWT signing key
+// @Summary Rotate the JWT signing key
+// @Description Create a new signing key; tokens signed with the previous key stay valid until they expire (admin only)
+// @Tags auth
+// @Produce json
+// @Success 201 {object} dto.SigningKeyResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /auth/keys/rotate [post]
+func RotateSigningKey(c *gin.Context) {
+	signingKey, err := utils.RotateSigningKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to rotate signing key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.SigningKeyResponse{
+		Kid:       signingKey.Kid,
+		Algorithm: signingKey.Algorithm,
+		CreatedAt: signingKey.CreatedAt,
+	})
+}
@@ -0,0 +1,414 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	throttleScopeTwoFactor = "2fa"
+	recoveryCodeCount      = 10
+)
+
+// SetupTwoFactor starts TOTP enrollment for the current user
+// @Summary Start 2FA enrollment
+// @Description Generate a TOTP secret and otpauth URI for the current user. 2FA is enabled once a code is confirmed.
+// @Tags users
+// @Produce json
+// @Success 200 {object} dto.TwoFactorSetupResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/2fa/setup [post]
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TotpEnabled {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to generate secret"})
+		return
+	}
+
+	if err := db.DB.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_counter": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to save secret"})
+		return
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "E-Commerce"
+	}
+
+	c.JSON(http.StatusOK, dto.TwoFactorSetupResponse{
+		Secret:     secret,
+		OtpauthURI: utils.TOTPURI(issuer, user.Email, secret),
+	})
+}
+
+// ConfirmTwoFactor enables 2FA after the user proves their authenticator app works
+// @Summary Confirm 2FA enrollment
+// @Description Verify a TOTP code for the pending secret, enable 2FA and return recovery codes and a fresh token
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param code body dto.TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} dto.TwoFactorConfirmResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/2fa/confirm [post]
+func ConfirmTwoFactor(c *gin.Context) {
+	// Only the customer can enroll their own authenticator
+	if _, impersonating := c.Get("impersonatorID"); impersonating {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "Not available while impersonating"})
+		return
+	}
+
+	var input dto.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TotpEnabled {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TotpSecret == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Two-factor setup has not been started"})
+		return
+	}
+
+	if !checkTOTP(c, &user, input.Code) {
+		return
+	}
+
+	var codes []string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to enable two-factor authentication"})
+		return
+	}
+
+	// The current token predates 2FA, so replace its session with one that carries the second factor
+	token, err := issueSessionToken(c, user, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Unable to generate token"})
+		return
+	}
+	if currentSessionID, exists := c.Get("sessionID"); exists {
+		db.DB.Model(&models.Session{}).Where("id = ?", currentSessionID).Update("revoked_at", time.Now())
+	}
+
+	c.JSON(http.StatusOK, dto.TwoFactorConfirmResponse{RecoveryCodes: codes, Token: token})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+// @Summary Regenerate 2FA recovery codes
+// @Description Invalidate existing recovery codes and return a new set
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param code body dto.TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} dto.RecoveryCodesResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input dto.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TotpEnabled {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !checkTOTP(c, &user, input.Code) {
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(db.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor turns off 2FA for the current user
+// @Summary Disable 2FA
+// @Description Disable two-factor authentication. Not allowed for admins while 2FA is mandatory. Accounts created through social login, which have no password, confirm with a login from the last REAUTH_MINUTES instead.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.TwoFactorDisableRequest true "Password and TOTP code"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/2fa/disable [post]
+func DisableTwoFactor(c *gin.Context) {
+	var input dto.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TotpEnabled {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if user.Role == "Admin" && os.Getenv("REQUIRE_ADMIN_2FA") != "false" {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "Two-factor authentication is mandatory for admin accounts"})
+		return
+	}
+
+	if !confirmIdentity(c, user, input.Password, "Invalid credentials") {
+		return
+	}
+
+	if !checkTOTP(c, &user, input.Code) {
+		return
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_counter": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Two-factor authentication disabled"})
+}
+
+// VerifyTwoFactorLogin completes a login that returned a 2FA challenge
+// @Summary Complete login with 2FA
+// @Description Exchange a challenge token and a TOTP or recovery code for a session token
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.TwoFactorLoginRequest true "Challenge token and code"
+// @Success 200 {object} dto.UserLoginResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/login/2fa [post]
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var input dto.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if input.Code == "" && input.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "A code or a recovery code is required"})
+		return
+	}
+
+	claims, err := utils.ParseJWT(input.ChallengeToken)
+	if err != nil || claims.Purpose != utils.PurposeTwoFactor {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid or expired challenge"})
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, claims.UserID).Error; err != nil || !user.TotpEnabled {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid or expired challenge"})
+		return
+	}
+
+	// The account may have been deactivated or erased since the password was checked.
+	// Deleted accounts are not found above.
+	if user.DeactivatedAt != nil || user.AnonymizedAt != nil {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "Account is deactivated"})
+		return
+	}
+
+	if input.RecoveryCode != "" {
+		if !useRecoveryCode(c, user, input.RecoveryCode) {
+			return
+		}
+	} else if !checkTOTP(c, &user, input.Code) {
+		return
+	}
+
+	respondWithLogin(c, user, true)
+}
+
+// currentUser loads the authenticated user, writing an error response when it cannot
+func currentUser(c *gin.Context) (models.User, bool) {
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	var user models.User
+	if err := db.DB.First(&user, userIDUint).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "User not found"})
+		return user, false
+	}
+	return user, true
+}
+
+// checkTOTP validates a code against the user's secret, throttling guesses and rejecting
+// codes that were already used. It writes the error response when the check fails.
+func checkTOTP(c *gin.Context, user *models.User, code string) bool {
+	identifier := strconv.FormatUint(uint64(user.ID), 10)
+	if twoFactorLocked(identifier) {
+		c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{Error: "Too many failed attempts, please try again later"})
+		return false
+	}
+
+	counter, valid := utils.ValidateTOTP(user.TotpSecret, code, time.Now())
+	if !valid || counter <= user.TotpLastCounter {
+		incrementLoginThrottle(throttleScopeTwoFactor, identifier)
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid code"})
+		return false
+	}
+
+	// Only move the counter forward so concurrent requests cannot replay the same code
+	result := db.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_counter < ?", user.ID, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid code"})
+		return false
+	}
+	user.TotpLastCounter = counter
+
+	clearThrottle(throttleScopeTwoFactor, identifier)
+	return true
+}
+
+// useRecoveryCode consumes one of the user's unused recovery codes
+func useRecoveryCode(c *gin.Context, user models.User, code string) bool {
+	identifier := strconv.FormatUint(uint64(user.ID), 10)
+	if twoFactorLocked(identifier) {
+		c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{Error: "Too many failed attempts, please try again later"})
+		return false
+	}
+
+	now := time.Now()
+	result := db.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", &now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		incrementLoginThrottle(throttleScopeTwoFactor, identifier)
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid recovery code"})
+		return false
+	}
+
+	clearThrottle(throttleScopeTwoFactor, identifier)
+	return true
+}
+
+// twoFactorLocked reports whether code guessing for the user is locked out
+func twoFactorLocked(identifier string) bool {
+	var count int64
+	db.DB.Model(&models.LoginThrottle{}).
+		Where("scope = ? AND identifier = ? AND locked_until > ?", throttleScopeTwoFactor, identifier, time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a new set
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		encoded := hex.EncodeToString(raw)
+		code := fmt.Sprintf("%s-%s", encoded[:5], encoded[5:])
+
+		if err := tx.Create(&models.RecoveryCode{UserId: userID, CodeHash: hashRecoveryCode(code)}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode normalises and hashes a recovery code for storage and lookup
+func hashRecoveryCode(code string) string {
+	normalised := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalised))
+	return hex.EncodeToString(sum[:])
+}
@@ -6,6 +6,8 @@ import (
 	"e-commerce/models"
 	"e-commerce/utils"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -49,6 +51,9 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
+	// Keep what the visitor put in their cart before signing up
+	mergeGuestCart(c, newUser.ID)
+
 	// Prepare response
 	userResponse := dto.UserRegisterResponse{
 		ID:    newUser.ID,
@@ -68,8 +73,10 @@ func RegisterUser(c *gin.Context) {
 // @Produce  json
 // @Param user body dto.UserLoginRequest true "User credentials"
 // @Success 200 {object} dto.UserLoginResponse
+// @Success 202 {object} dto.TwoFactorChallengeResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /users/login [post]
 func LoginUser(c *gin.Context) {
@@ -79,26 +86,90 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
 	// Retrieve user by email
 	var existingUser models.User
-	if err := db.DB.Where("email = ?", userInput.Email).First(&existingUser).Error; err != nil {
+	userErr := db.DB.Where("email = ?", userInput.Email).First(&existingUser).Error
+
+	// Always run bcrypt so the response time does not reveal whether the email exists
+	passwordHash := dummyPasswordHash
+	if userErr == nil && existingUser.Password != "" {
+		passwordHash = []byte(existingUser.Password)
+	}
+	passwordErr := bcrypt.CompareHashAndPassword(passwordHash, []byte(userInput.Password))
+
+	var userID *uint
+	if userErr == nil {
+		userID = &existingUser.ID
+	}
+
+	// Reject attempts while the account or the client IP is locked out
+	if lockedUntil := loginLockedUntil(userInput.Email, ip); lockedUntil != nil {
+		recordLoginFailure(userInput.Email, ip, userAgent, userID, "locked")
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(*lockedUntil).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{Error: "Too many failed login attempts, please try again later"})
+		return
+	}
+
+	if userErr != nil {
+		recordLoginFailure(userInput.Email, ip, userAgent, nil, "unknown_email")
 		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid credentials"})
 		return
 	}
 
-	// Compare stored hashed password with input password
-	if err := bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(userInput.Password)); err != nil {
+	// Compare stored hashed password with input password. Accounts created through social
+	// login have none and were compared against the dummy hash.
+	if passwordErr != nil || existingUser.Password == "" {
+		recordLoginFailure(userInput.Email, ip, userAgent, userID, "invalid_password")
 		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Invalid credentials"})
 		return
 	}
 
-	// Generate JWT token with user role
-	token, err := utils.GenerateJWT(existingUser.ID, existingUser.Role)
+	// A successful login clears the account's failure counter
+	if err := resetLoginThrottle(userInput.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to reset login attempts"})
+		return
+	}
+
+	completeLogin(c, existingUser)
+}
+
+// completeLogin finishes a first-factor login. Accounts with 2FA get a short-lived
+// challenge instead of a session token.
+func completeLogin(c *gin.Context, existingUser models.User) {
+	if existingUser.DeactivatedAt != nil {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "Account is deactivated"})
+		return
+	}
+
+	if existingUser.TotpEnabled {
+		challengeToken, err := utils.GenerateChallengeJWT(existingUser.ID, existingUser.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Unable to generate token"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, dto.TwoFactorChallengeResponse{TwoFactorRequired: true, ChallengeToken: challengeToken})
+		return
+	}
+
+	respondWithLogin(c, existingUser, false)
+}
+
+// respondWithLogin issues a session token for the user and writes the login response
+func respondWithLogin(c *gin.Context, existingUser models.User, mfa bool) {
+	// Generate JWT token with user role for a new session on this device
+	token, err := issueSessionToken(c, existingUser, mfa)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Unable to generate token"})
 		return
 	}
 
+	// Carry over what the visitor put in their cart before logging in
+	mergeGuestCart(c, existingUser.ID)
+
 	// Prepare response
 	userResponse := dto.UserRegisterResponse{
 		ID:    existingUser.ID,
@@ -114,3 +185,88 @@ func LoginUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, loginResponse)
 }
+
+// UnlockUser clears the login lockout of a user
+// @Summary Unlock a user account
+// @Description Clear failed login attempts and lift the lockout of a user and of the client IPs they failed to log in from (admin only)
+// @Tags users
+// @Produce json
+// @Param id path uint true "User ID"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/{id}/unlock [post]
+func UnlockUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "User not found"})
+		return
+	}
+
+	if err := resetLoginThrottle(user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to unlock user"})
+		return
+	}
+	if err := resetLoginThrottleIPs(user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "User unlocked"})
+}
+
+// GetLoginAttempts lists recent failed login attempts
+// @Summary Get failed login attempts
+// @Description Retrieve the latest failed login attempts, optionally filtered by email or IP (admin only)
+// @Tags users
+// @Produce json
+// @Param email query string false "Email"
+// @Param ip query string false "Client IP"
+// @Success 200 {array} dto.LoginAttemptResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /users/login-attempts [get]
+func GetLoginAttempts(c *gin.Context) {
+	query := db.DB.Order("created_at DESC").Limit(200)
+	if email := c.Query("email"); email != "" {
+		query = query.Where("email = ?", loginThrottleKey(email))
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+
+	var attempts []models.LoginAttempt
+	if err := query.Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch login attempts"})
+		return
+	}
+
+	var attemptResponses []dto.LoginAttemptResponse
+	for _, attempt := range attempts {
+		attemptResponses = append(attemptResponses, dto.LoginAttemptResponse{
+			ID:        attempt.ID,
+			UserID:    attempt.UserId,
+			Email:     attempt.Email,
+			IP:        attempt.IP,
+			UserAgent: attempt.UserAgent,
+			Reason:    attempt.Reason,
+			CreatedAt: attempt.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, attemptResponses)
+}
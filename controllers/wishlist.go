@@ -0,0 +1,522 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetWishlists lists the current user's wishlists
+// @Summary Get my wishlists
+// @Description Retrieve the wishlists of the current user with their items
+// @Tags wishlists
+// @Produce json
+// @Success 200 {array} dto.WishlistResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /wishlists [get]
+func GetWishlists(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	var wishlists []models.Wishlist
+	if err := db.DB.Preload("Items.Product").Where("user_id = ?", userIDUint).Order("id").Find(&wishlists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch wishlists"})
+		return
+	}
+
+	wishlistResponses := []dto.WishlistResponse{}
+	for _, wishlist := range wishlists {
+		wishlistResponses = append(wishlistResponses, mapToWishlistDTO(wishlist))
+	}
+
+	c.JSON(http.StatusOK, wishlistResponses)
+}
+
+// CreateWishlist creates a named wishlist for the current user
+// @Summary Create a wishlist
+// @Description Create a named wishlist, optionally shareable via a link
+// @Tags wishlists
+// @Accept json
+// @Produce json
+// @Param request body dto.WishlistRequest true "Wishlist"
+// @Success 201 {object} dto.WishlistResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /wishlists [post]
+func CreateWishlist(c *gin.Context) {
+	var input dto.WishlistRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	wishlist := models.Wishlist{UserId: userIDUint, Name: strings.TrimSpace(input.Name)}
+	if wishlist.Name == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Name cannot be empty"})
+		return
+	}
+	if err := setWishlistShared(&wishlist, input.Shared); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create share link"})
+		return
+	}
+
+	if err := db.DB.Create(&wishlist).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, mapToWishlistDTO(wishlist))
+}
+
+// GetWishlist retrieves one of the current user's wishlists
+// @Summary Get a wishlist
+// @Description Retrieve one of the current user's wishlists with its items
+// @Tags wishlists
+// @Produce json
+// @Param id path uint true "Wishlist ID"
+// @Success 200 {object} dto.WishlistResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /wishlists/{id} [get]
+func GetWishlist(c *gin.Context) {
+	wishlist, ok := findWishlist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, mapToWishlistDTO(wishlist))
+}
+
+// UpdateWishlist renames a wishlist or changes whether it is shared
+// @Summary Update a wishlist
+// @Description Rename a wishlist or turn its share link on or off. Turning sharing off invalidates the link.
+// @Tags wishlists
+// @Accept json
+// @Produce json
+// @Param id path uint true "Wishlist ID"
+// @Param request body dto.UpdateWishlistRequest true "Wishlist changes"
+// @Success 200 {object} dto.WishlistResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /wishlists/{id} [patch]
+func UpdateWishlist(c *gin.Context) {
+	var input dto.UpdateWishlistRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	wishlist, ok := findWishlist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if input.Name != nil {
+		wishlist.Name = strings.TrimSpace(*input.Name)
+		if wishlist.Name == "" {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Name cannot be empty"})
+			return
+		}
+	}
+	if input.Shared != nil {
+		if err := setWishlistShared(&wishlist, *input.Shared); err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create share link"})
+			return
+		}
+	}
+
+	if err := db.DB.Model(&wishlist).Select("name", "share_token").Updates(&wishlist).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to update wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapToWishlistDTO(wishlist))
+}
+
+// DeleteWishlist deletes one of the current user's wishlists
+// @Summary Delete a wishlist
+// @Description Delete one of the current user's wishlists with its items
+// @Tags wishlists
+// @Produce json
+// @Param id path uint true "Wishlist ID"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /wishlists/{id} [delete]
+func DeleteWishlist(c *gin.Context) {
+	wishlist, ok := findWishlist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("wishlist_id = ?", wishlist.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&wishlist).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to delete wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Wishlist deleted"})
+}
+
+// AddWishlistItem adds a product to a wishlist
+// @Summary Add a product to a wishlist
+// @Description Add a product to one of the current user's wishlists
+// @Tags wishlists
+// @Accept json
+// @Produce json
+// @Param id path uint true "Wishlist ID"
+// @Param request body dto.WishlistItemRequest true "Product"
+// @Success 201 {object} dto.WishlistResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /wishlists/{id}/items [post]
+func AddWishlistItem(c *gin.Context) {
+	var input dto.WishlistItemRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	wishlist, ok := findWishlist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var product models.Product
+	if err := db.DB.First(&product, input.ProductID).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Product not found"})
+		return
+	}
+
+	if err := addToWishlist(db.DB, wishlist.ID, product.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to add item to wishlist"})
+		return
+	}
+
+	wishlist, ok = findWishlist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusCreated, mapToWishlistDTO(wishlist))
+}
+
+// RemoveWishlistItem removes a product from a wishlist
+// @Summary Remove a product from a wishlist
+// @Description Remove an item from one of the current user's wishlists
+// @Tags wishlists
+// @Produce json
+// @Param id path uint true "Wishlist ID"
+// @Param itemId path uint true "Wishlist item ID"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /wishlists/{id}/items/{itemId} [delete]
+func RemoveWishlistItem(c *gin.Context) {
+	wishlist, ok := findWishlist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	result := db.DB.Where("id = ? AND wishlist_id = ?", c.Param("itemId"), wishlist.ID).Delete(&models.WishlistItem{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to remove item from wishlist"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Wishlist item not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Item removed from wishlist"})
+}
+
+// MoveWishlistItemToCart moves a wishlist item into the current user's cart
+// @Summary Move a wishlist item to the cart
+// @Description Add the smallest orderable quantity of the product to the cart and remove it from the wishlist
+// @Tags wishlists
+// @Produce json
+// @Param id path uint true "Wishlist ID"
+// @Param itemId path uint true "Wishlist item ID"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /wishlists/{id}/items/{itemId}/move-to-cart [post]
+func MoveWishlistItemToCart(c *gin.Context) {
+	wishlist, ok := findWishlist(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var item models.WishlistItem
+	if err := db.DB.Preload("Product").Where("id = ? AND wishlist_id = ?", c.Param("itemId"), wishlist.ID).
+		First(&item).Error; err != nil || item.Product.ID == 0 {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Wishlist item not found"})
+		return
+	}
+
+	var cartItem models.Cart
+	err := db.DB.Where("user_id = ? AND product_id = ?", wishlist.UserId, item.ProductId).First(&cartItem).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch cart items"})
+		return
+	}
+	quantity := cartItem.Quantity + smallestQuantity(item.Product)
+	if qe := checkCartQuantity(cartOwner{UserID: &wishlist.UserId}, item.Product, quantity); qe != nil {
+		qe.respond(c)
+		return
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if cartItem.ID == 0 {
+			cartItem = models.Cart{UserId: &wishlist.UserId, ProductId: item.ProductId, Quantity: quantity, PriceAtAdd: item.Product.Price}
+			if err := tx.Create(&cartItem).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(&cartItem).Updates(map[string]interface{}{
+			"quantity":        quantity,
+			"saved_for_later": false,
+			"price_at_add":    item.Product.Price,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&item).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to move item to cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Item moved to cart"})
+}
+
+// MoveCartItemToWishlist moves a cart item to one of the current user's wishlists
+// @Summary Move a cart item to a wishlist
+// @Description Remove an item from the cart and add its product to a wishlist
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param id path uint true "Cart Item ID"
+// @Param request body dto.MoveToWishlistRequest true "Wishlist"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @securityDefinitions.apiKey Authorization
+// @in header
+// @name Authorization
+// @Security JWT
+// @Router /cart/{id}/move-to-wishlist [post]
+func MoveCartItemToWishlist(c *gin.Context) {
+	var input dto.MoveToWishlistRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Guests have no wishlists
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Log in to use wishlists"})
+		return
+	}
+	userIDUint, _ := userID.(uint)
+
+	var cartItem models.Cart
+	if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userIDUint).First(&cartItem).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Cart item not found"})
+		return
+	}
+
+	wishlist, ok := findWishlist(c, strconv.FormatUint(uint64(input.WishlistID), 10))
+	if !ok {
+		return
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := addToWishlist(tx, wishlist.ID, cartItem.ProductId); err != nil {
+			return err
+		}
+		return tx.Delete(&cartItem).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to move item to wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Item moved to wishlist"})
+}
+
+// GetSharedWishlist shows a wishlist opened through its share link
+// @Summary Get a shared wishlist
+// @Description Retrieve a wishlist that its owner shared via a link
+// @Tags wishlists
+// @Produce json
+// @Param token path string true "Share token"
+// @Success 200 {object} dto.WishlistResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /wishlists/shared/{token} [get]
+func GetSharedWishlist(c *gin.Context) {
+	var wishlist models.Wishlist
+	if err := db.DB.Preload("Items.Product").Where("share_token = ?", c.Param("token")).First(&wishlist).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Wishlist not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapToWishlistDTO(wishlist))
+}
+
+// findWishlist loads a wishlist of the current user with its items. On failure the error
+// response is written and false is returned.
+func findWishlist(c *gin.Context, id string) (models.Wishlist, bool) {
+	var wishlist models.Wishlist
+	wishlistID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Invalid wishlist ID"})
+		return wishlist, false
+	}
+
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+
+	if err := db.DB.Preload("Items.Product").Where("id = ? AND user_id = ?", wishlistID, userIDUint).
+		First(&wishlist).Error; err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "Wishlist not found"})
+		return wishlist, false
+	}
+	return wishlist, true
+}
+
+// addToWishlist adds a product to a wishlist unless it is already on it
+func addToWishlist(tx *gorm.DB, wishlistID uint, productID uint) error {
+	item := models.WishlistItem{WishlistId: wishlistID, ProductId: productID}
+	return tx.Where(&item).FirstOrCreate(&item).Error
+}
+
+// setWishlistShared creates or removes the share token of a wishlist. A new token is
+// generated every time sharing is turned on, so old links stay invalid.
+func setWishlistShared(wishlist *models.Wishlist, shared bool) error {
+	if !shared {
+		wishlist.ShareToken = nil
+		return nil
+	}
+	if wishlist.ShareToken != nil {
+		return nil
+	}
+	token, err := utils.RandomToken(24)
+	if err != nil {
+		return err
+	}
+	wishlist.ShareToken = &token
+	return nil
+}
+
+// mapToWishlistDTO maps a wishlist and its items to the wishlist response DTO
+func mapToWishlistDTO(wishlist models.Wishlist) dto.WishlistResponse {
+	wishlistResponse := dto.WishlistResponse{
+		ID:        wishlist.ID,
+		Name:      wishlist.Name,
+		Shared:    wishlist.ShareToken != nil,
+		Items:     []dto.WishlistItemResponse{},
+		CreatedAt: wishlist.CreatedAt,
+	}
+	if wishlist.ShareToken != nil {
+		wishlistResponse.ShareURL = utils.AppURL() + "/wishlists/shared/" + *wishlist.ShareToken
+	}
+
+	for _, item := range wishlist.Items {
+		// Deleted products are not preloaded and are left out
+		if item.Product.ID == 0 {
+			continue
+		}
+		wishlistResponse.Items = append(wishlistResponse.Items, dto.WishlistItemResponse{
+			ID:        item.ID,
+			ProductID: item.ProductId,
+			Product:   mapToProductDetail(item.Product),
+			AddedAt:   item.CreatedAt,
+		})
+	}
+	return wishlistResponse
+}
+
+// queueWishlistNotification queues an email to the users who wishlisted a product when its
+// price drops or it comes back in stock. The emails are sent by the wishlist notification worker.
+func queueWishlistNotification(before models.Product, after models.Product) {
+	priceDropped := after.Price < before.Price
+	backInStock := before.Stock != nil && *before.Stock == 0 && (after.Stock == nil || *after.Stock > 0)
+	if !priceDropped && !backInStock {
+		return
+	}
+
+	notification := models.WishlistNotification{
+		ProductId: after.ID,
+		Subject:   after.Name + " is back in stock",
+		Body:      fmt.Sprintf("%s from your wishlist is available again.", after.Name),
+	}
+	if priceDropped {
+		notification.Subject = "Price drop on " + after.Name
+		notification.Body = fmt.Sprintf("%s from your wishlist dropped in price from %.2f to %.2f.", after.Name, before.Price, after.Price)
+	}
+	notification.Body += "\n\n" + utils.AppURL() + "/products/" + strconv.FormatUint(uint64(after.ID), 10)
+
+	if err := db.DB.Create(&notification).Error; err != nil {
+		log.Println("Failed to queue wishlist notification:", err)
+	}
+}
@@ -1,11 +1,15 @@
 package dto
 
+import "time"
+
 // CartItemResponse represents the response for a cart item
 type CartItemResponse struct {
-	ID        uint          `json:"id"`
-	ProductID uint          `json:"productId"`
-	Product   ProductDetail `json:"product"`
-	Quantity  uint          `json:"quantity"`
+	ID           uint          `json:"id"`
+	ProductID    uint          `json:"productId"`
+	Product      ProductDetail `json:"product"`
+	Quantity     uint          `json:"quantity"`
+	UnitPrice    float64       `json:"unitPrice"`
+	LineSubtotal float64       `json:"lineSubtotal"`
 }
 
 // ProductDetail represents the detailed information of a product in the cart
@@ -15,8 +19,78 @@ type ProductDetail struct {
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
 	Photo       string  `json:"photo"`
+	InStock     bool    `json:"inStock"`
+}
+
+// CartResponse represents the cart with the items saved for later listed separately
+type CartResponse struct {
+	Items         []CartItemResponse `json:"items"`
+	SavedForLater []CartItemResponse `json:"savedForLater"`
+	Summary       CartSummary        `json:"summary"`
+	// Impersonation is set while an admin is looking at the customer's cart
+	Impersonation *ImpersonationNotice `json:"impersonation,omitempty"`
+}
+
+// CartSummary represents the price breakdown of the items in the cart. Items saved for
+// later are not included.
+type CartSummary struct {
+	ItemCount uint    `json:"itemCount"`
+	Subtotal  float64 `json:"subtotal"`
+	Discount  float64 `json:"discount"`
+	Tax       float64 `json:"tax"`
+	Shipping  float64 `json:"shipping"`
+	Total     float64 `json:"total"`
 }
 
+// UpdateQuantity represents the request body for changing a cart item quantity. 0 removes the item.
 type UpdateQuantity struct {
-	Quantity uint `json:"quantity"`
+	Quantity *uint `json:"quantity" binding:"required"`
+}
+
+// ValidateCartRequest represents the request body for validating the cart before checkout
+type ValidateCartRequest struct {
+	Acknowledge bool `json:"acknowledge"`
+}
+
+// CartIssue describes a change to a cart item since it was added
+type CartIssue struct {
+	CartItemID    uint    `json:"cartItemId"`
+	ProductID     uint    `json:"productId"`
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	Message       string  `json:"message"`
+	PreviousPrice float64 `json:"previousPrice,omitempty"`
+	CurrentPrice  float64 `json:"currentPrice,omitempty"`
+	Available     *uint   `json:"available,omitempty"`
+}
+
+// CartValidationResponse lists the changes that have to be acknowledged before checkout
+type CartValidationResponse struct {
+	Error  string      `json:"error,omitempty"`
+	Valid  bool        `json:"valid"`
+	Issues []CartIssue `json:"issues"`
+	// Acknowledged lists the issues the cart was updated for when they were acknowledged
+	Acknowledged []CartIssue `json:"acknowledged,omitempty"`
+}
+
+// RestoreCartResponse represents an abandoned cart opened through the link in a reminder email
+type RestoreCartResponse struct {
+	Items           []CartItemResponse `json:"items"`
+	Summary         CartSummary        `json:"summary"`
+	CouponCode      string             `json:"couponCode,omitempty"`
+	CouponExpiresAt *time.Time         `json:"couponExpiresAt,omitempty"`
+}
+
+// AbandonedCartReport represents how many abandoned carts were recovered by reminder emails
+type AbandonedCartReport struct {
+	From             time.Time `json:"from"`
+	To               time.Time `json:"to"`
+	RemindersSent    int64     `json:"remindersSent"`
+	CartsReminded    int64     `json:"cartsReminded"`
+	LinksClicked     int64     `json:"linksClicked"`
+	CartsRecovered   int64     `json:"cartsRecovered"`
+	RecoveryRate     float64   `json:"recoveryRate"`
+	RecoveredRevenue float64   `json:"recoveredRevenue"`
+	CouponsIssued    int64     `json:"couponsIssued"`
+	CouponsRedeemed  int64     `json:"couponsRedeemed"`
 }
@@ -0,0 +1,47 @@
+package dto
+
+import "time"
+
+// DataRequestResponse represents the status of a data export or erasure request
+type DataRequestResponse struct {
+	ID          uint       `json:"id"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	DownloadURL string     `json:"downloadUrl,omitempty"`
+}
+
+// DataExport is the content of a GDPR data export archive
+type DataExport struct {
+	ExportedAt time.Time            `json:"exportedAt"`
+	Profile    UserProfileResponse  `json:"profile"`
+	Identities []DataExportIdentity `json:"identities"`
+	Cart       []CartItemResponse   `json:"cart"`
+	// SavedForLater lists the cart items moved out of the cart to buy later
+	SavedForLater []CartItemResponse `json:"savedForLater"`
+	Wishlists     []WishlistResponse `json:"wishlists"`
+	Orders        []OrderResponseDTO `json:"orders"`
+	// Messages lists the messages about the orders the customer could see
+	Messages []DataExportMessage `json:"messages"`
+}
+
+// DataExportMessage is a message in the thread of one of the user's orders
+type DataExportMessage struct {
+	OrderID        uint   `json:"orderId"`
+	FromStaff      bool   `json:"fromStaff"`
+	Body           string `json:"body"`
+	AttachmentName string `json:"attachmentName,omitempty"`
+	// AttachmentFile is where the attachment is in the archive
+	AttachmentFile string    `json:"attachmentFile,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// DataExportIdentity is an external login linked to the account
+type DataExportIdentity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -3,4 +3,5 @@ package dto
 // ErrorResponse represents the structure of an error response
 type ErrorResponse struct {
     Error string `json:"error"`
+    Code  string `json:"code,omitempty"`
 }
\ No newline at end of file
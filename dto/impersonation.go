@@ -0,0 +1,23 @@
+package dto
+
+import "time"
+
+// ImpersonateRequest represents the request body for impersonating a user
+type ImpersonateRequest struct {
+	Reason      string `json:"reason" binding:"required"`
+	AllowWrites bool   `json:"allowWrites"`
+}
+
+// ImpersonationNotice flags a response seen by an admin acting as the customer
+type ImpersonationNotice struct {
+	ImpersonatedBy uint `json:"impersonatedBy"`
+	ReadOnly       bool `json:"readOnly"`
+}
+
+// ImpersonationResponse carries the short-lived token that acts as the user
+type ImpersonationResponse struct {
+	Token     string               `json:"token"`
+	ExpiresAt time.Time            `json:"expiresAt"`
+	ReadOnly  bool                 `json:"readOnly"`
+	User      UserRegisterResponse `json:"user"`
+}
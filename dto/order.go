@@ -4,18 +4,32 @@ import "time"
 
 // OrderResponseDTO represents the response body for an order
 type OrderResponseDTO struct {
-	ID          uint                     `json:"id"`
-	Bill        float64                  `json:"bill"`
-	CurrentDate time.Time                `json:"currentDate"`
-	Inventory   []InventoryResponseDTO   `json:"inventory"`
+	ID             uint                   `json:"id"`
+	Status         string                 `json:"status"`
+	Subtotal       float64                `json:"subtotal"`
+	Discount       float64                `json:"discount"`
+	CouponID       *uint                  `json:"couponId,omitempty"`
+	Tax            float64                `json:"tax"`
+	Shipping       float64                `json:"shipping"`
+	Bill           float64                `json:"bill"`
+	CurrentDate    time.Time              `json:"currentDate"`
+	CustomerNote   string                 `json:"customerNote,omitempty"`
+	UnreadMessages int64                  `json:"unreadMessages"`
+	Inventory      []InventoryResponseDTO `json:"inventory"`
+	// Impersonation is set while an admin is looking at the customer's orders
+	Impersonation *ImpersonationNotice `json:"impersonation,omitempty"`
 }
 
 // InventoryResponseDTO represents the response body for inventory items
 type InventoryResponseDTO struct {
-	ID       uint    `json:"id"`
-	Name     string  `json:"name"`
-	Price    float64 `json:"price"`
-	Quantity uint    `json:"quantity"`
+	ID          uint    `json:"id"`
+	ProductID   *uint   `json:"productId"`
+	Name        string  `json:"name"`
+	SKU         string  `json:"sku"`
+	Description string  `json:"description"`
+	Photo       string  `json:"photo"`
+	Price       float64 `json:"price"`
+	Quantity    uint    `json:"quantity"`
 }
 
 // UserResponseDTO represents the structure of a user response
@@ -24,3 +38,133 @@ type UserResponseDTO struct {
 	Name  string `json:"name"`
 	Email string `json:"email"`
 }
+
+// GuestCheckoutRequest represents the request body for placing an order without an account
+type GuestCheckoutRequest struct {
+	Email   string `json:"email" binding:"required,email"`
+	Name    string `json:"name" binding:"required"`
+	Address string `json:"address" binding:"required"`
+	Note    string `json:"note" binding:"max=1000"`
+}
+
+// GuestOrderResponse represents a placed guest order with the token of its lookup link.
+// The token is empty if the link could not be signed.
+type GuestOrderResponse struct {
+	Order       OrderResponseDTO `json:"order"`
+	LookupToken string           `json:"lookupToken,omitempty"`
+}
+
+// OrderLookupResponse represents an order opened through its signed lookup link
+type OrderLookupResponse struct {
+	OrderResponseDTO
+	Email           string `json:"email"`
+	ShippingName    string `json:"shippingName"`
+	ShippingAddress string `json:"shippingAddress"`
+	Claimed         bool   `json:"claimed"`
+}
+
+// GuestAccountRequest represents the request body for turning a guest order into an account
+type GuestAccountRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// ClaimGuestOrdersRequest represents the request body for attaching guest orders to an account
+type ClaimGuestOrdersRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ClaimGuestOrdersResponse represents the number of guest orders attached to an account
+type ClaimGuestOrdersResponse struct {
+	Claimed int64 `json:"claimed"`
+}
+
+// CheckoutRequest represents the optional request body for placing an order from the cart
+type CheckoutRequest struct {
+	CouponCode string `json:"couponCode"`
+	Note       string `json:"note" binding:"max=1000"` // e.g. delivery instructions
+}
+
+// ReorderItem represents a line of a past order that was added to the cart
+type ReorderItem struct {
+	CartItemID uint    `json:"cartItemId"`
+	ProductID  uint    `json:"productId"`
+	Name       string  `json:"name"`
+	Quantity   uint    `json:"quantity"`
+	Price      float64 `json:"price"`
+}
+
+// ReorderResponse lists what was added to the cart from a past order and what changed since
+type ReorderResponse struct {
+	Added  []ReorderItem `json:"added"`
+	Issues []CartIssue   `json:"issues"`
+}
+
+// AdminOrderQuery represents the filters, sorting and page of the admin order search
+type AdminOrderQuery struct {
+	Page      int      `form:"page" binding:"omitempty,min=1"`
+	PageSize  int      `form:"pageSize" binding:"omitempty,min=1,max=100"`
+	From      string   `form:"from"`
+	To        string   `form:"to"`
+	Status    string   `form:"status"`
+	Email     string   `form:"email"`
+	MinTotal  *float64 `form:"minTotal"`
+	MaxTotal  *float64 `form:"maxTotal"`
+	ProductID *uint    `form:"productId"`
+	Sort      string   `form:"sort" binding:"omitempty,oneof=date -date total -total status -status"`
+}
+
+// OrderCustomer represents the customer who placed an order
+type OrderCustomer struct {
+	UserID *uint  `json:"userId"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Guest  bool   `json:"guest"`
+}
+
+// AdminOrderResponse represents an order with its customer for admins
+type AdminOrderResponse struct {
+	OrderResponseDTO
+	Customer OrderCustomer `json:"customer"`
+}
+
+// AdminOrderPage represents one page of the admin order search
+type AdminOrderPage struct {
+	Orders   []AdminOrderResponse `json:"orders"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"pageSize"`
+	Total    int64                `json:"total"`
+}
+
+// OrderStatusChange represents a status an order went through
+type OrderStatusChange struct {
+	Status    string    `json:"status"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OrderDetailResponse represents an order with its shipping details and status history
+type OrderDetailResponse struct {
+	OrderResponseDTO
+	Customer        OrderCustomer       `json:"customer"`
+	ShippingName    string              `json:"shippingName"`
+	ShippingAddress string              `json:"shippingAddress"`
+	StatusHistory   []OrderStatusChange `json:"statusHistory"`
+}
+
+// UpdateOrderStatusRequest represents the request body for changing the status of an order
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=placed processing shipped delivered cancelled refunded"`
+	Note   string `json:"note"`
+}
+
+// OrderMessageResponse represents a message in the thread of an order
+type OrderMessageResponse struct {
+	ID             uint       `json:"id"`
+	FromStaff      bool       `json:"fromStaff"`
+	Internal       bool       `json:"internal,omitempty"`
+	Body           string     `json:"body"`
+	AttachmentName string     `json:"attachmentName,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ReadAt         *time.Time `json:"readAt"` // when the other side read the message
+}
@@ -3,20 +3,38 @@ package dto
 // ProductRequest represents the request body for creating or updating a product
 type ProductRequest struct {
 	Name        string  `form:"name" json:"name" binding:"required"`
+	SKU         string  `form:"sku" json:"sku"`
 	Description string  `form:"description" json:"description" binding:"required"`
 	Price       float64 `form:"price" json:"price" binding:"required"`
 	Photo       string  `form:"photo" json:"photo"`
+	ProductStockRules
+}
+
+// ProductStockRules represents the optional stock and quantity rules of a product
+type ProductStockRules struct {
+	Stock         *uint `form:"stock" json:"stock"`
+	MinQuantity   *uint `form:"minQuantity" json:"minQuantity"`
+	MaxQuantity   *uint `form:"maxQuantity" json:"maxQuantity"`
+	QuantityStep  *uint `form:"quantityStep" json:"quantityStep"`
+	PurchaseLimit *uint `form:"purchaseLimit" json:"purchaseLimit"`
 }
 
 // ProductResponse represents the response body for a product
 type ProductResponse struct {
-	ID          uint    `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Photo       string  `json:"photo"`
-	CreatedAt   string  `json:"created_at"`
-	UpdatedAt   string  `json:"updated_at"`
+	ID            uint    `json:"id"`
+	Name          string  `json:"name"`
+	SKU           string  `json:"sku"`
+	Description   string  `json:"description"`
+	Price         float64 `json:"price"`
+	Photo         string  `json:"photo"`
+	PhotoKey      string  `json:"photoKey"`
+	Stock         *uint   `json:"stock"`
+	MinQuantity   uint    `json:"minQuantity"`
+	MaxQuantity   uint    `json:"maxQuantity"`
+	QuantityStep  uint    `json:"quantityStep"`
+	PurchaseLimit uint    `json:"purchaseLimit"`
+	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     string  `json:"updated_at"`
 }
 
 // AddToCartRequest represents the request body for adding a product to the cart
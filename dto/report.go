@@ -0,0 +1,60 @@
+package dto
+
+import "time"
+
+// SalesPeriod represents the sales of one day, week or month
+type SalesPeriod struct {
+	Period            string  `json:"period"`
+	Orders            int64   `json:"orders"`
+	Revenue           float64 `json:"revenue"`
+	AverageOrderValue float64 `json:"averageOrderValue"`
+}
+
+// SalesReport represents revenue and order counts over a date range
+type SalesReport struct {
+	From              time.Time     `json:"from"`
+	To                time.Time     `json:"to"`
+	Interval          string        `json:"interval"`
+	Timezone          string        `json:"timezone"`
+	Orders            int64         `json:"orders"`
+	Revenue           float64       `json:"revenue"`
+	AverageOrderValue float64       `json:"averageOrderValue"`
+	Periods           []SalesPeriod `json:"periods"`
+}
+
+// TopProduct represents how much of a product was sold
+type TopProduct struct {
+	ProductID *uint   `json:"productId"`
+	Name      string  `json:"name"`
+	Quantity  int64   `json:"quantity"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// TopProductsReport represents the best selling products over a date range
+type TopProductsReport struct {
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	By       string       `json:"by"`
+	Products []TopProduct `json:"products"`
+}
+
+// CustomerReport represents how many customers ordered for the first time or again
+type CustomerReport struct {
+	From               time.Time `json:"from"`
+	To                 time.Time `json:"to"`
+	Customers          int64     `json:"customers"`
+	NewCustomers       int64     `json:"newCustomers"`
+	ReturningCustomers int64     `json:"returningCustomers"`
+	NewRevenue         float64   `json:"newRevenue"`
+	ReturningRevenue   float64   `json:"returningRevenue"`
+}
+
+// RefundReport represents how many orders were refunded
+type RefundReport struct {
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	Orders          int64     `json:"orders"`
+	RefundedOrders  int64     `json:"refundedOrders"`
+	RefundRate      float64   `json:"refundRate"`
+	RefundedRevenue float64   `json:"refundedRevenue"`
+}
@@ -0,0 +1,14 @@
+package dto
+
+import "time"
+
+// SessionResponse represents a device the user is logged in on
+type SessionResponse struct {
+	ID           uint      `json:"id"`
+	UserAgent    string    `json:"userAgent"`
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActiveAt time.Time `json:"lastActiveAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	Current      bool      `json:"current"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+import (
+	"e-commerce/utils"
+	"time"
+)
+
+// JWKSResponse is the JSON Web Key Set used by other services to verify our tokens
+type JWKSResponse struct {
+	Keys []utils.JSONWebKey `json:"keys"`
+}
+
+// SigningKeyResponse describes a signing key without its private part
+type SigningKeyResponse struct {
+	Kid       string    `json:"kid"`
+	Algorithm string    `json:"algorithm"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,43 @@
+package dto
+
+// TwoFactorChallengeResponse is returned by login when a second factor is required
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+// TwoFactorLoginRequest completes a login with a TOTP code or a recovery code
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+// TwoFactorSetupResponse carries the secret to add to an authenticator app
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthUri"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code from the user's authenticator app
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorConfirmResponse is returned once 2FA is enabled
+type TwoFactorConfirmResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+	Token         string   `json:"token"`
+}
+
+// RecoveryCodesResponse lists newly generated recovery codes
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// TwoFactorDisableRequest requires both the password and a current code. Accounts without a
+// password confirm with a recent social login instead and leave it empty.
+type TwoFactorDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code" binding:"required"`
+}
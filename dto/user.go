@@ -1,33 +1,89 @@
 package dto
 
+import "time"
+
 // UserRegisterRequest represents the request body for user registration
 type UserRegisterRequest struct {
-    Name     string `json:"name" binding:"required"`
-    Email    string `json:"email" binding:"required,email"`
-    Password string `json:"password" binding:"required"`
-    Role     string `json:"role" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
 }
 
 // UserRegisterResponse represents the response body for user registration
 type UserRegisterResponse struct {
-    ID    uint   `json:"id"`
-    Name  string `json:"name"`
-    Email string `json:"email"`
-    Role  string `json:"role"`
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
 }
 
 // UserLoginRequest represents the request body for user login
 type UserLoginRequest struct {
-    Email    string `json:"email" binding:"required,email"`
-    Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
 }
 
 // UserLoginResponse represents the response body for user login
 type UserLoginResponse struct {
-    User  UserRegisterResponse `json:"user"`
-    Token string               `json:"token"`
+	User  UserRegisterResponse `json:"user"`
+	Token string               `json:"token"`
 }
 
 type SuccessResponse struct {
-    Message string `json:"message"`
-}
\ No newline at end of file
+	Message string `json:"message"`
+}
+
+// LoginAttemptResponse represents an audited failed login
+type LoginAttemptResponse struct {
+	ID        uint      `json:"id"`
+	UserID    *uint     `json:"userId"`
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UserProfileResponse represents the current user's profile
+type UserProfileResponse struct {
+	ID               uint   `json:"id"`
+	Name             string `json:"name"`
+	Email            string `json:"email"`
+	Role             string `json:"role"`
+	PendingEmail     string `json:"pendingEmail,omitempty"`
+	EmailVerified    bool   `json:"emailVerified"`
+	TwoFactorEnabled bool   `json:"twoFactorEnabled"`
+	// HasPassword is false for accounts created through social login until a password is set
+	HasPassword bool      `json:"hasPassword"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// UpdateProfileRequest represents the fields a user can change on their profile
+type UpdateProfileRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// ChangePasswordRequest represents the request body for changing the password. Accounts
+// without a password set their first one without the current password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword" binding:"required,min=8"`
+}
+
+// ChangeEmailRequest represents the request body for changing the email address
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail" binding:"required,email"`
+	Password string `json:"password"`
+}
+
+// VerifyEmailRequest represents the request body for confirming an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// PasswordConfirmationRequest is used by actions that must be confirmed with the password.
+// Accounts without a password confirm with a recent social login instead and leave it empty.
+type PasswordConfirmationRequest struct {
+	Password string `json:"password"`
+}
@@ -0,0 +1,43 @@
+package dto
+
+import "time"
+
+// WishlistRequest represents the request body for creating a wishlist
+type WishlistRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Shared bool   `json:"shared"`
+}
+
+// UpdateWishlistRequest represents the request body for renaming or (un)sharing a wishlist
+type UpdateWishlistRequest struct {
+	Name   *string `json:"name"`
+	Shared *bool   `json:"shared"`
+}
+
+// WishlistItemRequest represents the request body for adding a product to a wishlist
+type WishlistItemRequest struct {
+	ProductID uint `json:"productId" binding:"required"`
+}
+
+// MoveToWishlistRequest represents the request body for moving a cart item to a wishlist
+type MoveToWishlistRequest struct {
+	WishlistID uint `json:"wishlistId" binding:"required"`
+}
+
+// WishlistResponse represents a wishlist with its items
+type WishlistResponse struct {
+	ID        uint                   `json:"id"`
+	Name      string                 `json:"name"`
+	Shared    bool                   `json:"shared"`
+	ShareURL  string                 `json:"shareUrl,omitempty"`
+	Items     []WishlistItemResponse `json:"items"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// WishlistItemResponse represents a product on a wishlist
+type WishlistItemResponse struct {
+	ID        uint          `json:"id"`
+	ProductID uint          `json:"productId"`
+	Product   ProductDetail `json:"product"`
+	AddedAt   time.Time     `json:"addedAt"`
+}
@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// abandonedCart is a user whose cart has not changed for a while
+type abandonedCart struct {
+	UserId       uint
+	LastActivity time.Time
+}
+
+// StartAbandonedCartWorker emails users about carts they left without checking out. A cart is
+// abandoned when it has not changed for ABANDONED_CART_HOURS; up to ABANDONED_CART_MAX_REMINDERS
+// reminders are sent that far apart, and the last one carries a coupon when
+// ABANDONED_CART_COUPON_PERCENT is set.
+func StartAbandonedCartWorker() {
+	interval := time.Duration(utils.GetEnvInt("ABANDONED_CART_POLL_MINUTES", 15)) * time.Minute
+
+	go func() {
+		for {
+			sendCartReminders()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func sendCartReminders() {
+	idle := time.Duration(utils.GetEnvInt("ABANDONED_CART_HOURS", 24)) * time.Hour
+
+	var carts []abandonedCart
+	err := db.DB.Model(&models.Cart{}).
+		Select("carts.user_id, MAX(carts.updated_at) AS last_activity").
+		Joins("JOIN users ON users.id = carts.user_id AND users.deactivated_at IS NULL AND users.deleted_at IS NULL").
+		Where("carts.user_id IS NOT NULL AND carts.saved_for_later = ?", false).
+		Group("carts.user_id").
+		Having("MAX(carts.updated_at) < ?", time.Now().Add(-idle)).
+		Scan(&carts).Error
+	if err != nil {
+		log.Println("Failed to find abandoned carts:", err)
+		return
+	}
+
+	for _, cart := range carts {
+		if err := remindAbandonedCart(cart, idle); err != nil {
+			log.Printf("Failed to send cart reminder to user %d: %v", cart.UserId, err)
+		}
+	}
+}
+
+// remindAbandonedCart sends the next reminder about a cart when one is due. The user row is
+// locked with SKIP LOCKED while the email is sent, so several instances never send the same
+// reminder twice.
+func remindAbandonedCart(cart abandonedCart, idle time.Duration) error {
+	maxReminders := utils.GetEnvInt("ABANDONED_CART_MAX_REMINDERS", 2)
+
+	var user models.User
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			First(&user, cart.UserId).Error; err != nil {
+			return err
+		}
+
+		// Reminders sent before the cart last changed were about an earlier cart
+		var sent []models.CartReminder
+		if err := tx.Where("user_id = ? AND sent_at IS NOT NULL AND created_at > ?", user.ID, cart.LastActivity).
+			Order("created_at DESC").Find(&sent).Error; err != nil {
+			return err
+		}
+		if len(sent) >= maxReminders || (len(sent) > 0 && time.Since(sent[0].CreatedAt) < idle) {
+			return errNoReminderDue
+		}
+
+		reminder := models.CartReminder{UserId: user.ID, Sequence: uint(len(sent) + 1)}
+
+		// The last reminder tries to win the customer back with a coupon
+		percent := utils.GetEnvFloat("ABANDONED_CART_COUPON_PERCENT", 0)
+		if len(sent)+1 == maxReminders && percent > 0 {
+			token, err := utils.RandomToken(16)
+			if err != nil {
+				return err
+			}
+			coupon := models.Coupon{
+				Code:      strings.ToUpper(utils.HashToken(token)[:10]),
+				Percent:   percent,
+				UserId:    &user.ID,
+				ExpiresAt: time.Now().AddDate(0, 0, utils.GetEnvInt("ABANDONED_CART_COUPON_DAYS", 7)),
+			}
+			if err := tx.Create(&coupon).Error; err != nil {
+				return err
+			}
+			reminder.CouponId = &coupon.ID
+			reminder.Coupon = &coupon
+		}
+
+		if err := tx.Omit("Coupon").Create(&reminder).Error; err != nil {
+			return err
+		}
+
+		// The reminder is only kept when the email went out, so a failed send is retried
+		// on the next run
+		if err := sendCartReminder(tx, user, reminder); err != nil {
+			return err
+		}
+		return tx.Model(&reminder).Update("sent_at", time.Now()).Error
+	})
+	if errors.Is(err, errNoReminderDue) || errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// sendCartReminder emails the user the items in their cart with a link to restore it
+func sendCartReminder(tx *gorm.DB, user models.User, reminder models.CartReminder) error {
+	var items []models.Cart
+	if err := tx.Preload("Product").Where("user_id = ? AND saved_for_later = ?", user.ID, false).
+		Order("id").Find(&items).Error; err != nil {
+		return err
+	}
+
+	token, err := utils.SignLink(utils.LinkCartRestore, reminder.ID, user.Email)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nYou left these items in your cart:\n\n", user.Name)
+	for _, item := range items {
+		if item.Product.ID != 0 {
+			fmt.Fprintf(&body, "- %s x %d\n", item.Product.Name, item.Quantity)
+		}
+	}
+	if reminder.Coupon != nil {
+		fmt.Fprintf(&body, "\nUse code %s for %s%% off, valid until %s.\n",
+			reminder.Coupon.Code, strconv.FormatFloat(reminder.Coupon.Percent, 'f', -1, 64), reminder.Coupon.ExpiresAt.Format("January 2, 2006"))
+	}
+	fmt.Fprintf(&body, "\nPick up where you left off:\n\n%s/cart/restore?token=%s", utils.AppURL(), token)
+
+	return utils.Mail.Send(user.Email, "You left something in your cart", body.String())
+}
+
+// errNoReminderDue ends the reminder transaction without sending anything
+var errNoReminderDue = errors.New("no reminder due")
@@ -0,0 +1,426 @@
+package jobs
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/dto"
+	"e-commerce/models"
+	"e-commerce/storage"
+	"e-commerce/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DataRequestExport  = "export"
+	DataRequestErasure = "erasure"
+
+	DataRequestPending    = "pending"
+	DataRequestProcessing = "processing"
+	DataRequestCompleted  = "completed"
+	DataRequestFailed     = "failed"
+
+	// exportLifetime is how long a finished export can be downloaded
+	exportLifetime = 7 * 24 * time.Hour
+	// staleProcessing requeues requests whose worker died mid-way
+	staleProcessing = time.Hour
+)
+
+// ExportsDir returns the directory where export archives are written
+func ExportsDir() string {
+	if dir := os.Getenv("EXPORTS_DIR"); dir != "" {
+		return dir
+	}
+	return "exports"
+}
+
+// StartDataRequestWorker processes pending data export and erasure requests in the background.
+// Requests are claimed with SKIP LOCKED so several instances can run the worker.
+func StartDataRequestWorker() {
+	interval := time.Duration(utils.GetEnvInt("DATA_REQUEST_POLL_SECONDS", 15)) * time.Second
+	os.MkdirAll(ExportsDir(), os.ModePerm)
+
+	go func() {
+		for {
+			processDataRequests()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func processDataRequests() {
+	db.DB.Model(&models.DataRequest{}).
+		Where("status = ? AND updated_at < ?", DataRequestProcessing, time.Now().Add(-staleProcessing)).
+		Update("status", DataRequestPending)
+
+	removeExpiredExports()
+
+	for {
+		request, ok := claimDataRequest()
+		if !ok {
+			return
+		}
+
+		var filePath string
+		var err error
+		switch request.Type {
+		case DataRequestExport:
+			filePath, err = exportUserData(request)
+		case DataRequestErasure:
+			err = eraseUserData(request.UserId)
+		default:
+			err = fmt.Errorf("unknown request type %q", request.Type)
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{"status": DataRequestCompleted, "completed_at": now}
+		if err != nil {
+			log.Printf("data request %d failed: %v", request.ID, err)
+			updates = map[string]interface{}{"status": DataRequestFailed, "error": "Processing failed, please try again"}
+		} else if filePath != "" {
+			updates["file_path"] = filePath
+			updates["expires_at"] = now.Add(exportLifetime)
+		}
+		db.DB.Model(&request).Updates(updates)
+	}
+}
+
+// claimDataRequest marks the oldest pending request as processing and returns it
+func claimDataRequest() (models.DataRequest, bool) {
+	var request models.DataRequest
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", DataRequestPending).Order("id").First(&request).Error; err != nil {
+			return err
+		}
+		return tx.Model(&request).Update("status", DataRequestProcessing).Error
+	})
+	return request, err == nil
+}
+
+// exportUserData writes a zip archive with the user's profile, cart, saved items, wishlists,
+// orders and order messages. Message attachments are added to the archive as files.
+func exportUserData(request models.DataRequest) (string, error) {
+	var user models.User
+	if err := db.DB.First(&user, request.UserId).Error; err != nil {
+		return "", err
+	}
+
+	var identities []models.UserIdentity
+	var cartItems []models.Cart
+	var wishlists []models.Wishlist
+	var orders []models.Order
+	var messages []models.OrderMessage
+	if err := db.DB.Where("user_id = ?", user.ID).Find(&identities).Error; err != nil {
+		return "", err
+	}
+	// Deleted products are still part of the user's data
+	if err := db.DB.Preload("Product", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Where("user_id = ?", user.ID).Order("id").Find(&cartItems).Error; err != nil {
+		return "", err
+	}
+	if err := db.DB.Preload("Items.Product", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Where("user_id = ?", user.ID).Order("id").Find(&wishlists).Error; err != nil {
+		return "", err
+	}
+	// Guest orders placed with the user's email are erased with the account, so they are exported too
+	if err := db.DB.Preload("Inventory").Where("id IN (?)", userOrderIDs(db.DB, user)).Order("id").Find(&orders).Error; err != nil {
+		return "", err
+	}
+	if err := db.DB.Where("order_id IN (?) AND internal = ?", userOrderIDs(db.DB, user), false).
+		Order("order_id, created_at, id").Find(&messages).Error; err != nil {
+		return "", err
+	}
+
+	export := dto.DataExport{
+		ExportedAt: time.Now(),
+		Profile: dto.UserProfileResponse{
+			ID:               user.ID,
+			Name:             user.Name,
+			Email:            user.Email,
+			Role:             user.Role,
+			PendingEmail:     user.PendingEmail,
+			EmailVerified:    user.EmailVerifiedAt != nil,
+			TwoFactorEnabled: user.TotpEnabled,
+			CreatedAt:        user.CreatedAt,
+		},
+		Identities:    []dto.DataExportIdentity{},
+		Cart:          []dto.CartItemResponse{},
+		SavedForLater: []dto.CartItemResponse{},
+		Wishlists:     []dto.WishlistResponse{},
+		Orders:        []dto.OrderResponseDTO{},
+		Messages:      []dto.DataExportMessage{},
+	}
+	for _, identity := range identities {
+		export.Identities = append(export.Identities, dto.DataExportIdentity{
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+	for _, cartItem := range cartItems {
+		item := dto.CartItemResponse{
+			ID:        cartItem.ID,
+			ProductID: cartItem.ProductId,
+			Product:   exportProductDetail(cartItem.Product),
+			Quantity:  cartItem.Quantity,
+		}
+		if cartItem.SavedForLater {
+			export.SavedForLater = append(export.SavedForLater, item)
+		} else {
+			export.Cart = append(export.Cart, item)
+		}
+	}
+	for _, wishlist := range wishlists {
+		wishlistExport := dto.WishlistResponse{
+			ID:        wishlist.ID,
+			Name:      wishlist.Name,
+			Shared:    wishlist.ShareToken != nil,
+			Items:     []dto.WishlistItemResponse{},
+			CreatedAt: wishlist.CreatedAt,
+		}
+		for _, item := range wishlist.Items {
+			wishlistExport.Items = append(wishlistExport.Items, dto.WishlistItemResponse{
+				ID:        item.ID,
+				ProductID: item.ProductId,
+				Product:   exportProductDetail(item.Product),
+				AddedAt:   item.CreatedAt,
+			})
+		}
+		export.Wishlists = append(export.Wishlists, wishlistExport)
+	}
+	for _, order := range orders {
+		orderExport := dto.OrderResponseDTO{
+			ID:           order.ID,
+			Status:       order.Status,
+			Subtotal:     order.Subtotal,
+			Discount:     order.Discount,
+			Tax:          order.Tax,
+			Shipping:     order.Shipping,
+			Bill:         order.Bill,
+			CurrentDate:  order.CurrentDate,
+			CustomerNote: order.CustomerNote,
+		}
+		for _, item := range order.Inventory {
+			orderExport.Inventory = append(orderExport.Inventory, dto.InventoryResponseDTO{
+				ID:          item.ID,
+				ProductID:   item.ProductId,
+				Name:        item.Name,
+				SKU:         item.SKU,
+				Description: item.Description,
+				Photo:       storage.URL(item.PhotoKey, item.Photo),
+				Price:       item.Price,
+				Quantity:    item.Quantity,
+			})
+		}
+		export.Orders = append(export.Orders, orderExport)
+	}
+
+	token, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	filePath := filepath.Join(ExportsDir(), fmt.Sprintf("export_%d_%s.zip", user.ID, token))
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	for _, message := range messages {
+		messageExport := dto.DataExportMessage{
+			OrderID:        message.OrderId,
+			FromStaff:      message.FromStaff,
+			Body:           message.Body,
+			AttachmentName: message.AttachmentName,
+			CreatedAt:      message.CreatedAt,
+		}
+		if message.AttachmentKey != "" || message.AttachmentPath != "" {
+			messageExport.AttachmentFile, err = exportAttachment(archive, message)
+			if err != nil {
+				os.Remove(filePath)
+				return "", err
+			}
+		}
+		export.Messages = append(export.Messages, messageExport)
+	}
+
+	entry, err := archive.Create("data.json")
+	if err != nil {
+		return "", err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return "", err
+	}
+	if err := archive.Close(); err != nil {
+		os.Remove(filePath)
+		return "", err
+	}
+	return filePath, nil
+}
+
+// exportAttachment copies a message attachment into the archive and returns its file name there
+func exportAttachment(archive *zip.Writer, message models.OrderMessage) (string, error) {
+	var content io.ReadCloser
+	var err error
+	// Attachments sent before the blob store are files on this instance
+	if message.AttachmentKey == "" {
+		content, err = os.Open(message.AttachmentPath)
+	} else {
+		content, err = storage.Default.Get(context.Background(), message.AttachmentKey)
+	}
+	if err != nil {
+		return "", fmt.Errorf("attachment of message %d: %w", message.ID, err)
+	}
+	defer content.Close()
+
+	// The name was chosen by whoever uploaded it, so only its base name is used
+	base := path.Base(strings.ReplaceAll("/"+message.AttachmentName, "\\", "/"))
+	if base == "/" {
+		base = "attachment"
+	}
+	name := fmt.Sprintf("attachments/%d_%s", message.ID, base)
+	entry, err := archive.Create(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(entry, content); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// exportProductDetail describes a product in an export, including deleted ones
+func exportProductDetail(product models.Product) dto.ProductDetail {
+	return dto.ProductDetail{
+		ID:          product.ID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Photo:       storage.URL(product.PhotoKey, product.Photo),
+	}
+}
+
+// eraseUserData anonymises the user's personal data. Orders and their line items are kept
+// for accounting retention but only point to the anonymised user afterwards.
+func eraseUserData(userID uint) error {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	anonymisedEmail := fmt.Sprintf("deleted-%d@deleted.invalid", user.ID)
+
+	var exports []models.DataRequest
+	db.DB.Where("user_id = ? AND file_path <> ''", user.ID).Find(&exports)
+
+	// Records are matched by the email the user had before it is anonymised
+	customer := user
+
+	var attachments []models.OrderMessage
+	db.DB.Where("order_id IN (?) AND from_staff = ? AND (attachment_key <> '' OR attachment_path <> '')", userOrderIDs(db.DB, customer), false).
+		Find(&attachments)
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"name":              "Deleted user",
+			"email":             anonymisedEmail,
+			"password":          "",
+			"pending_email":     "",
+			"email_verified_at": nil,
+			"totp_secret":       "",
+			"totp_enabled":      false,
+			"deactivated_at":    gorm.Expr("COALESCE(deactivated_at, ?)", now),
+			"anonymized_at":     now,
+		}).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{&models.Cart{}, &models.RecoveryCode{}, &models.UserIdentity{}, &models.EmailVerification{}, &models.Session{}} {
+			if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		wishlists := tx.Model(&models.Wishlist{}).Select("id").Where("user_id = ?", user.ID)
+		if err := tx.Unscoped().Where("wishlist_id IN (?)", wishlists).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Wishlist{}).Error; err != nil {
+			return err
+		}
+
+		// Messages the customer wrote about their orders are emptied before the orders lose their email
+		if err := tx.Model(&models.OrderMessage{}).
+			Where("order_id IN (?) AND from_staff = ?", userOrderIDs(tx, customer), false).
+			Updates(map[string]interface{}{"body": "", "attachment_key": "", "attachment_path": "", "attachment_name": ""}).Error; err != nil {
+			return err
+		}
+
+		// Orders are kept for accounting, but without the contact and shipping details
+		if err := tx.Model(&models.Order{}).Where("id IN (?)", userOrderIDs(tx, customer)).
+			Updates(map[string]interface{}{"guest_email": "", "shipping_name": "", "shipping_address": "", "customer_note": ""}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.LoginAttempt{}).Where("user_id = ? OR email = LOWER(?)", customer.ID, customer.Email).
+			Updates(map[string]interface{}{"email": anonymisedEmail, "ip": "", "user_agent": ""}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("scope = ? AND identifier = LOWER(?)", "account", customer.Email).
+			Delete(&models.LoginThrottle{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.DataRequest{}).Where("user_id = ? AND file_path <> ''", user.ID).
+			Update("file_path", "").Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		os.Remove(export.FilePath)
+	}
+	for _, attachment := range attachments {
+		if attachment.AttachmentKey == "" {
+			os.Remove(attachment.AttachmentPath)
+		} else if err := storage.Default.Delete(context.Background(), attachment.AttachmentKey); err != nil {
+			log.Printf("Failed to delete attachment %s: %v", attachment.AttachmentKey, err)
+		}
+	}
+	return nil
+}
+
+// userOrderIDs selects the IDs of the orders a user placed, with their account or as a guest
+func userOrderIDs(tx *gorm.DB, user models.User) *gorm.DB {
+	return tx.Model(&models.Order{}).Select("id").
+		Where("user_id = ? OR (user_id IS NULL AND LOWER(guest_email) = LOWER(?))", user.ID, user.Email)
+}
+
+// removeExpiredExports deletes export archives that can no longer be downloaded
+func removeExpiredExports() {
+	var expired []models.DataRequest
+	db.DB.Where("file_path <> '' AND expires_at < ?", time.Now()).Find(&expired)
+	for _, request := range expired {
+		os.Remove(request.FilePath)
+		db.DB.Model(&request).Update("file_path", "")
+	}
+}
@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/models"
+
+	"gorm.io/gorm"
+)
+
+// StartGuestCartCleanup removes expired guest carts and their items once an hour
+func StartGuestCartCleanup() {
+	go func() {
+		for {
+			removeExpiredGuestCarts()
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+func removeExpiredGuestCarts() {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&models.GuestCart{}).Select("id").Where("expires_at < ?", time.Now())
+		if err := tx.Unscoped().Where("guest_cart_id IN (?)", expired).Delete(&models.Cart{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.GuestCart{}).Error
+	})
+	if err != nil {
+		log.Println("Failed to remove expired guest carts:", err)
+	}
+}
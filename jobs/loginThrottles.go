@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/models"
+	"e-commerce/utils"
+)
+
+// StartLoginThrottleCleanup removes stale failed login counters once an hour. Every failed
+// login creates one, including logins with emails nobody registered, so they would
+// otherwise pile up.
+func StartLoginThrottleCleanup() {
+	go func() {
+		for {
+			removeStaleLoginThrottles()
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// removeStaleLoginThrottles deletes counters whose last failure is older than the failure
+// window and whose lockout has ended. They would be reset on the next failure anyway.
+func removeStaleLoginThrottles() {
+	now := time.Now()
+	window := time.Duration(utils.GetEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 60)) * time.Minute
+	err := db.DB.Unscoped().
+		Where("(last_failure_at IS NULL OR last_failure_at < ?) AND (locked_until IS NULL OR locked_until < ?)", now.Add(-window), now).
+		Delete(&models.LoginThrottle{}).Error
+	if err != nil {
+		log.Println("Failed to remove stale login throttles:", err)
+	}
+}
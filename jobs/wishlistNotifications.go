@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/models"
+	"e-commerce/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StartWishlistNotificationWorker emails the users who wishlisted a product about queued price
+// drops and restocks one at a time. Notifications are claimed with SKIP LOCKED so several
+// instances can run the worker.
+func StartWishlistNotificationWorker() {
+	interval := time.Duration(utils.GetEnvInt("WISHLIST_NOTIFY_POLL_SECONDS", 60)) * time.Second
+
+	go func() {
+		for {
+			sendWishlistNotifications()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func sendWishlistNotifications() {
+	for {
+		sent, err := sendWishlistNotification()
+		if err != nil {
+			log.Println("Failed to send wishlist notification:", err)
+			return
+		}
+		if !sent {
+			return
+		}
+	}
+}
+
+// sendWishlistNotification sends the oldest queued notification and reports whether there was one.
+// It is marked sent in the same transaction that holds its lock, so no other instance sends it again.
+func sendWishlistNotification() (bool, error) {
+	found := false
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var notification models.WishlistNotification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL").Order("id").First(&notification).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+
+		var emails []string
+		if err := tx.Model(&models.User{}).Distinct().
+			Joins("JOIN wishlists ON wishlists.user_id = users.id AND wishlists.deleted_at IS NULL").
+			Joins("JOIN wishlist_items ON wishlist_items.wishlist_id = wishlists.id AND wishlist_items.deleted_at IS NULL").
+			Where("wishlist_items.product_id = ? AND users.deactivated_at IS NULL", notification.ProductId).
+			Pluck("users.email", &emails).Error; err != nil {
+			return err
+		}
+
+		for _, email := range emails {
+			if err := utils.Mail.Send(email, notification.Subject, notification.Body); err != nil {
+				log.Printf("Failed to send wishlist notification %d to %s: %v", notification.ID, email, err)
+			}
+		}
+		return tx.Model(&notification).Update("sent_at", time.Now()).Error
+	})
+	return found, err
+}
@@ -5,8 +5,11 @@ import (
 	"os"
 
 	"e-commerce/db"
+	"e-commerce/jobs"
 	"e-commerce/models"
 	"e-commerce/routes"
+	"e-commerce/storage"
+	"e-commerce/utils"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -44,13 +47,33 @@ func main() {
 	db.InitDatabase()
 	models.MigrateDatabase()
 
+	if err := utils.InitKeyRing(); err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+
+	if err := utils.CheckLinkSigning(); err != nil {
+		log.Fatal("Failed to set up link signing: ", err)
+	}
+
+	if err := storage.Init(); err != nil {
+		log.Fatal("Failed to set up file storage: ", err)
+	}
+
+	utils.InitMailer()
+
+	jobs.StartDataRequestWorker()
+	jobs.StartGuestCartCleanup()
+	jobs.StartLoginThrottleCleanup()
+	jobs.StartAbandonedCartWorker()
+	jobs.StartWishlistNotificationWorker()
+
 	router := gin.Default()
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"}, // Frontend origin
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Cart-Token"},
+		ExposeHeaders:    []string{"Content-Length", "X-Impersonation", "X-Impersonated-By", "X-Cart-Token"},
 		AllowCredentials: true,
 	}))
 
@@ -60,13 +83,21 @@ func main() {
 		})
 	})
 
-	os.MkdirAll("uploads", os.ModePerm)
-	router.Static("/uploads", "./uploads")
+	// Files in S3-compatible storage are downloaded from the bucket, not through the application
+	if local, ok := storage.Default.(*storage.Local); ok {
+		os.MkdirAll(local.Dir, os.ModePerm)
+		router.Static(storage.LocalURLPrefix, local.Dir)
+	}
 
 	routes.RegisterProductRoutes(router)
 	routes.RegisterUserRoutes(router)
 	routes.RegisterCartRoutes(router)
 	routes.RegisterOrderRoutes(router)
+	routes.RegisterAuthRoutes(router)
+	routes.RegisterAPIKeyRoutes(router)
+	routes.RegisterAuditLogRoutes(router)
+	routes.RegisterWishlistRoutes(router)
+	routes.RegisterReportRoutes(router)
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 
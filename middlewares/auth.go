@@ -1,17 +1,32 @@
 package middlewares
 
 import (
+	"crypto/subtle"
+	"e-commerce/db"
+	"e-commerce/models"
 	"e-commerce/utils"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates the JWT token
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware validates the JWT token. When scopes are given, an API key holding
+// all of them is accepted instead of a JWT.
+func AuthMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := apiKeyFromRequest(c); apiKey != "" {
+			if len(scopes) == 0 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "API keys are not accepted for this endpoint"})
+				c.Abort()
+				return
+			}
+			authenticateAPIKey(c, apiKey, scopes)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
@@ -26,19 +41,204 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims := &utils.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return utils.JwtSecret, nil
-		})
+		claims, err := utils.ParseJWT(tokenString)
 
-		if err != nil || !token.Valid {
+		// Purpose tokens such as 2FA challenges are not valid for API access
+		if err != nil || claims.Purpose != "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		// Tokens of deactivated or deleted users stop working immediately
+		var activeUsers int64
+		db.DB.Model(&models.User{}).Where("id = ? AND deactivated_at IS NULL", claims.UserID).Count(&activeUsers)
+		if activeUsers == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is not active"})
+			c.Abort()
+			return
+		}
+
+		// Every token belongs to a session and stops working as soon as it is revoked. Tokens
+		// without a session were issued before sessions were tracked and are not accepted.
+		var session models.Session
+		if claims.Id == "" || db.DB.Where("token_id = ? AND user_id = ? AND revoked_at IS NULL", claims.Id, claims.UserID).
+			First(&session).Error != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Only write activity once a minute to keep requests cheap
+		if time.Since(session.LastActiveAt) > time.Minute {
+			db.DB.Model(&session).UpdateColumns(map[string]interface{}{"last_active_at": time.Now(), "ip": c.ClientIP()})
+		}
+		c.Set("sessionID", session.ID)
+
+		if claims.ActorID != 0 {
+			authenticateImpersonation(c, claims)
+			return
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("userRole", claims.Role)
+		c.Set("mfa", claims.MFA)
 		c.Next()
 	}
 }
+
+// OptionalAuthMiddleware authenticates the request like AuthMiddleware when credentials are
+// sent and lets anonymous requests through otherwise
+func OptionalAuthMiddleware(scopes ...string) gin.HandlerFunc {
+	authenticate := AuthMiddleware(scopes...)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" && c.GetHeader("X-API-Key") == "" {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
+
+// impersonationDeniedRoutes are customer routes support staff cannot open while acting as
+// the user, whatever the access mode. They expose more than the customer's view or change
+// how the customer signs in, which only the customer may do.
+var impersonationDeniedRoutes = map[string]bool{
+	"PATCH /users/me":                          true,
+	"POST /users/me/password":                  true,
+	"POST /users/me/email":                     true,
+	"POST /users/me/deactivate":                true,
+	"GET /users/me/sessions":                   true,
+	"DELETE /users/me/sessions/:id":            true,
+	"POST /users/me/sessions/revoke-others":    true,
+	"POST /users/me/data-export":               true,
+	"POST /users/me/erasure":                   true,
+	"GET /users/me/data-requests/:id/download": true,
+	"POST /users/2fa/setup":                    true,
+	"POST /users/2fa/confirm":                  true,
+	"POST /users/2fa/recovery-codes":           true,
+	"POST /users/2fa/disable":                  true,
+}
+
+// authenticateImpersonation runs a request made by an admin acting as a user. The response
+// is flagged with headers, read-only tokens are limited to safe methods, sensitive routes
+// are refused and every request is written to the audit log.
+func authenticateImpersonation(c *gin.Context, claims *utils.Claims) {
+	var activeAdmins int64
+	db.DB.Model(&models.User{}).Where("id = ? AND role = ? AND deactivated_at IS NULL", claims.ActorID, "Admin").Count(&activeAdmins)
+	if activeAdmins == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation is no longer allowed"})
+		c.Abort()
+		return
+	}
+
+	mode := "read-write"
+	if claims.ReadOnly {
+		mode = "read-only"
+	}
+	c.Header("X-Impersonation", mode)
+	c.Header("X-Impersonated-By", strconv.FormatUint(uint64(claims.ActorID), 10))
+
+	defer func() {
+		db.DB.Create(&models.AuditLog{
+			ActorType: "impersonation",
+			ActorID:   claims.ActorID,
+			SubjectId: claims.UserID,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+	}()
+
+	if claims.ReadOnly && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation session is read-only"})
+		c.Abort()
+		return
+	}
+	if impersonationDeniedRoutes[c.Request.Method+" "+c.FullPath()] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not available while impersonating"})
+		c.Abort()
+		return
+	}
+
+	c.Set("userID", claims.UserID)
+	c.Set("userRole", claims.Role)
+	c.Set("impersonatorID", claims.ActorID)
+	c.Set("impersonationReadOnly", claims.ReadOnly)
+	c.Next()
+}
+
+// apiKeyFromRequest reads a key from "Authorization: ApiKey <key>" or the X-API-Key header
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	authHeader := c.GetHeader("Authorization")
+	if strings.HasPrefix(authHeader, "ApiKey ") {
+		return strings.TrimSpace(strings.TrimPrefix(authHeader, "ApiKey "))
+	}
+	return ""
+}
+
+// authenticateAPIKey validates the key and its scopes, then runs the handler and audits the request
+func authenticateAPIKey(c *gin.Context, key string, scopes []string) {
+	prefix, ok := utils.ParseAPIKeyPrefix(key)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	var apiKey models.APIKey
+	now := time.Now()
+	if err := db.DB.Where("prefix = ?", prefix).First(&apiKey).Error; err != nil ||
+		subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(utils.HashAPIKey(key))) != 1 ||
+		apiKey.RevokedAt != nil ||
+		(apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt)) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	// Every request made with a valid key is audited, including rejected ones
+	defer func() {
+		db.DB.Create(&models.AuditLog{
+			ActorType: "api_key",
+			ActorID:   apiKey.ID,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+	}()
+
+	// Only write last-used once a minute to keep busy integrations cheap
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute {
+		db.DB.Model(&apiKey).UpdateColumn("last_used_at", now)
+	}
+
+	granted := strings.Fields(apiKey.Scopes)
+	for _, scope := range scopes {
+		if !containsScope(granted, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the required scope: " + scope})
+			c.Abort()
+			return
+		}
+	}
+
+	c.Set("apiKeyID", apiKey.ID)
+	c.Set("apiKeyScopes", granted)
+	c.Next()
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
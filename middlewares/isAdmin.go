@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,19 +10,33 @@ import (
 // AdminMiddleware checks if the user is an admin
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("userRole")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found in context"})
-			c.Abort()
+		if IsAdmin(c) {
+			c.Next()
 			return
 		}
 
-		if role.(string) != "Admin" {
+		role, exists := c.Get("userRole")
+		switch {
+		case !exists:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found in context"})
+		case role != "Admin":
 			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access, admin role required"})
-			c.Abort()
-			return
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for admin accounts"})
 		}
+		c.Abort()
+	}
+}
 
-		c.Next()
+// IsAdmin reports whether the authenticated request is allowed on admin routes. It is the
+// policy AdminMiddleware enforces, for routes that serve both customers and admins.
+func IsAdmin(c *gin.Context) bool {
+	// API keys are admin-issued and were already checked for the route's scopes
+	if _, isAPIKey := c.Get("apiKeyID"); isAPIKey {
+		return true
 	}
+	role, _ := c.Get("userRole")
+	// Admins must have signed in with a second factor unless the policy is turned off
+	mfa, _ := c.Get("mfa")
+	return role == "Admin" && (os.Getenv("REQUIRE_ADMIN_2FA") == "false" || mfa == true)
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey is an admin-managed credential for server-to-server integrations.
+// Only a SHA-256 hash of the key is stored; the prefix identifies the key in lookups and logs.
+type APIKey struct {
+	gorm.Model
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix" gorm:"uniqueIndex"`
+	KeyHash     string     `json:"-"`
+	Scopes      string     `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+	RevokedAt   *time.Time `json:"revokedAt"`
+	CreatedById uint       `json:"createdById"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// AuditLog records a request made by a non-interactive or privileged actor.
+// SubjectId is the user the actor acted on behalf of, if any.
+type AuditLog struct {
+	gorm.Model
+	ActorType string `json:"actorType" gorm:"index:idx_audit_log_actor"`
+	ActorID   uint   `json:"actorId" gorm:"index:idx_audit_log_actor"`
+	SubjectId uint   `json:"subjectId" gorm:"index"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Status    int    `json:"status"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Details   string `json:"details"`
+}
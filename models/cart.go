@@ -4,11 +4,15 @@ import (
 	"gorm.io/gorm"
 )
 
+// Cart is a cart line owned either by a user or by a guest cart
 type Cart struct {
 	gorm.Model
-	UserId    uint    `json:"userId"`
-	User      User    `gorm:"foreignKey:UserId"`
-	ProductId uint    `json:"productId"`
-	Product   Product `gorm:"foreignKey:ProductId"`
-	Quantity  uint    `json:"quantity"`
+	UserId        *uint   `json:"userId" gorm:"index"`
+	User          User    `gorm:"foreignKey:UserId"`
+	GuestCartId   *uint   `json:"-" gorm:"index"`
+	ProductId     uint    `json:"productId"`
+	Product       Product `gorm:"foreignKey:ProductId"`
+	Quantity      uint    `json:"quantity"`
+	PriceAtAdd    float64 `json:"priceAtAdd"` // price the customer saw when adding the item
+	SavedForLater bool    `json:"savedForLater"`
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CartReminder is an email sent about an abandoned cart. An order placed after it
+// marks the cart as recovered.
+type CartReminder struct {
+	gorm.Model
+	UserId      uint       `json:"userId" gorm:"index"`
+	Sequence    uint       `json:"sequence"` // 1 for the first reminder about the same cart
+	CouponId    *uint      `json:"couponId"`
+	Coupon      *Coupon    `gorm:"foreignKey:CouponId"`
+	SentAt      *time.Time `json:"sentAt"`
+	ClickedAt   *time.Time `json:"clickedAt"`
+	RecoveredAt *time.Time `json:"recoveredAt"`
+	OrderId     *uint      `json:"orderId"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Coupon takes a percentage off an order. Coupons with a UserId can only be used by that user.
+type Coupon struct {
+	gorm.Model
+	Code      string     `json:"code" gorm:"uniqueIndex"`
+	Percent   float64    `json:"percent"`
+	UserId    *uint      `json:"userId" gorm:"index"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	OrderId   *uint      `json:"orderId"`
+}
@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// DataMigration records a one-time data migration that has run
+type DataMigration struct {
+	Name      string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DataRequest is a GDPR data export or erasure request, processed in the background
+type DataRequest struct {
+	gorm.Model
+	UserId      uint       `json:"userId" gorm:"index"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status" gorm:"index"`
+	FilePath    string     `json:"-"`
+	Error       string     `json:"error"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailVerification is a pending confirmation of an email address sent to that address
+type EmailVerification struct {
+	gorm.Model
+	UserId    uint       `json:"userId" gorm:"index"`
+	Email     string     `json:"email"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GuestCart holds the cart of an anonymous visitor. Only a hash of its opaque token is stored.
+type GuestCart struct {
+	gorm.Model
+	TokenHash string    `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Items     []Cart    `gorm:"foreignKey:GuestCartId"`
+}
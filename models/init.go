@@ -3,11 +3,88 @@ package models
 import (
 	"e-commerce/db"
 	"log"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 func MigrateDatabase() {
-	err := db.DB.AutoMigrate(&User{}, &Product{}, &Cart{}, &Order{})
+	err := db.DB.AutoMigrate(
+		&User{},
+		&Product{},
+		&GuestCart{},
+		&Cart{},
+		&Order{},
+		&Inventory{},
+		&Wishlist{},
+		&WishlistItem{},
+		&LoginThrottle{},
+		&LoginAttempt{},
+		&RecoveryCode{},
+		&OIDCState{},
+		&UserIdentity{},
+		&APIKey{},
+		&AuditLog{},
+		&SigningKey{},
+		&EmailVerification{},
+		&DataRequest{},
+		&Session{},
+		&Coupon{},
+		&CartReminder{},
+		&OrderStatusHistory{},
+		&OrderMessage{},
+		&WishlistNotification{},
+		&DataMigration{},
+	)
 	if err != nil {
 		log.Fatal("Failed to migrate database: ", err)
 	}
+
+	runDataMigration("backfill_inventory_products", backfillInventoryProducts)
+	runDataMigration("backfill_cart_reminder_sent_at", backfillCartReminderSentAt)
+	runDataMigration("clear_social_login_passwords", clearSocialLoginPasswords)
+}
+
+// runDataMigration runs a data migration unless it ran before. The migration and its record
+// share a transaction, so a failed migration is tried again on the next start.
+func runDataMigration(name string, migrate func(tx *gorm.DB) error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec("INSERT INTO data_migrations (name, applied_at) VALUES (?, ?) ON CONFLICT DO NOTHING", name, time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return migrate(tx)
+	})
+	if err != nil {
+		log.Printf("Data migration %s failed: %v", name, err)
+	}
+}
+
+// backfillInventoryProducts links order lines from before line items kept their product to
+// the product of the same name. Names shared by several products are left unlinked.
+func backfillInventoryProducts(tx *gorm.DB) error {
+	return tx.Exec(`UPDATE inventories SET
+			product_id = products.id,
+			sku = CASE WHEN inventories.sku = '' THEN products.sku ELSE inventories.sku END,
+			description = CASE WHEN inventories.description = '' THEN products.description ELSE inventories.description END,
+			photo = CASE WHEN inventories.photo = '' THEN products.photo ELSE inventories.photo END
+		FROM products
+		WHERE inventories.product_id IS NULL AND products.deleted_at IS NULL AND products.name = inventories.name
+			AND (SELECT COUNT(*) FROM products same WHERE same.deleted_at IS NULL AND same.name = inventories.name) = 1`).Error
+}
+
+// backfillCartReminderSentAt marks reminders from before sends were recorded as sent when
+// they were created. Reminders are only kept once their email went out.
+func backfillCartReminderSentAt(tx *gorm.DB) error {
+	return tx.Exec("UPDATE cart_reminders SET sent_at = created_at WHERE sent_at IS NULL").Error
+}
+
+// clearSocialLoginPasswords removes the random password accounts created through social login
+// used to get. Nobody knows it, so those accounts are marked as having no password instead.
+// They are the accounts whose first identity was linked in the transaction that created them.
+func clearSocialLoginPasswords(tx *gorm.DB) error {
+	return tx.Exec(`UPDATE users SET password = ''
+		WHERE EXISTS (SELECT 1 FROM user_identities
+			WHERE user_identities.user_id = users.id
+				AND user_identities.created_at < users.created_at + INTERVAL '5 seconds')`).Error
 }
@@ -6,9 +6,15 @@ import (
 
 type Inventory struct {
 	gorm.Model
-	OrderId  uint    `json:"orderId"`
-	Order    Order   `gorm:"foreignKey:OrderId"`
-	Name     string  `json:"name"`
-	Price    float64 `json:"price"`
-	Quantity uint    `json:"quantity"`
+	OrderId     uint     `json:"orderId"`
+	Order       Order    `gorm:"foreignKey:OrderId"`
+	ProductId   *uint    `json:"productId" gorm:"index"` // nil when the line could not be matched to a product
+	Product     *Product `gorm:"foreignKey:ProductId;constraint:OnDelete:SET NULL"`
+	Name        string   `json:"name"`
+	SKU         string   `json:"sku"`
+	Description string   `json:"description"`
+	Photo       string   `json:"photo"`
+	PhotoKey    string   `json:"photoKey"`
+	Price       float64  `json:"price"`
+	Quantity    uint     `json:"quantity"`
 }
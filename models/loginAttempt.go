@@ -0,0 +1,15 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// LoginAttempt is an audit record of a failed login
+type LoginAttempt struct {
+	gorm.Model
+	UserId    *uint  `json:"userId"`
+	Email     string `json:"email" gorm:"index"`
+	IP        string `json:"ip" gorm:"index"`
+	UserAgent string `json:"userAgent"`
+	Reason    string `json:"reason"`
+}
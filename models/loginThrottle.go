@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LoginThrottle tracks consecutive failed logins for an account (by email) or a client IP
+type LoginThrottle struct {
+	gorm.Model
+	Scope         string     `json:"scope" gorm:"uniqueIndex:idx_login_throttle_scope_identifier"`
+	Identifier    string     `json:"identifier" gorm:"uniqueIndex:idx_login_throttle_scope_identifier"`
+	Failures      uint       `json:"failures"`
+	LastFailureAt *time.Time `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OIDCState keeps the state, nonce and PKCE verifier of an in-flight OpenID Connect login
+type OIDCState struct {
+	gorm.Model
+	State        string    `json:"-" gorm:"uniqueIndex"`
+	Provider     string    `json:"provider"`
+	Nonce        string    `json:"-"`
+	CodeVerifier string    `json:"-"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
@@ -6,11 +6,23 @@ import (
 	"gorm.io/gorm"
 )
 
+// Order is placed either by a user or, for guest checkout, by an email address without an account
 type Order struct {
 	gorm.Model
-	UserId      uint        `json:"userId"`
-	User        User        `gorm:"foreignKey:UserId"`
-	Bill        float64     `json:"bill"`
-	CurrentDate time.Time   `json:"currentDate"`
-	Inventory   []Inventory `gorm:"foreignKey:OrderId"`
+	UserId          *uint                `json:"userId" gorm:"index"`
+	User            User                 `gorm:"foreignKey:UserId"`
+	GuestEmail      string               `json:"guestEmail" gorm:"index"`
+	ShippingName    string               `json:"shippingName"`
+	ShippingAddress string               `json:"shippingAddress"`
+	CustomerNote    string               `json:"customerNote"` // e.g. delivery instructions given at checkout
+	Status          string               `json:"status" gorm:"default:placed"`
+	Subtotal        float64              `json:"subtotal"`
+	Discount        float64              `json:"discount"`
+	CouponId        *uint                `json:"couponId"`
+	Tax             float64              `json:"tax"`
+	Shipping        float64              `json:"shipping"`
+	Bill            float64              `json:"bill"`
+	CurrentDate     time.Time            `json:"currentDate"`
+	Inventory       []Inventory          `gorm:"foreignKey:OrderId"`
+	StatusHistory   []OrderStatusHistory `gorm:"foreignKey:OrderId"`
 }
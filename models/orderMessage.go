@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OrderMessage is a message in the thread between a customer and staff about an order.
+// Internal messages are staff notes the customer never sees.
+type OrderMessage struct {
+	gorm.Model
+	OrderId          uint       `json:"orderId" gorm:"index"`
+	AuthorId         *uint      `json:"authorId"`
+	FromStaff        bool       `json:"fromStaff"`
+	Internal         bool       `json:"internal"`
+	Body             string     `json:"body"`
+	AttachmentKey    string     `json:"-"` // object key in the blob store
+	AttachmentPath   string     `json:"-"` // file of attachments sent before the blob store
+	AttachmentName   string     `json:"attachmentName"`
+	ReadByCustomerAt *time.Time `json:"readByCustomerAt"`
+	ReadByStaffAt    *time.Time `json:"readByStaffAt"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// OrderStatusHistory records every status an order went through
+type OrderStatusHistory struct {
+	gorm.Model
+	OrderId uint   `json:"orderId" gorm:"index"`
+	Status  string `json:"status"`
+	Note    string `json:"note"`    // shown to the customer
+	ActorId *uint  `json:"actorId"` // user who changed the status, nil for API keys
+}
@@ -6,9 +6,16 @@ import (
 
 type Product struct {
 	gorm.Model
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Photo       string  `json:"photo"`
-	Carts       []Cart  `gorm:"foreignKey:ProductId"`
+	Name          string  `json:"name"`
+	SKU           string  `json:"sku" gorm:"index"`
+	Description   string  `json:"description"`
+	Price         float64 `json:"price"`
+	Photo         string  `json:"photo"`         // URL of the photo in responses, the path of photos stored before PhotoKey
+	PhotoKey      string  `json:"photoKey"`      // object key of the photo in the blob store
+	Stock         *uint   `json:"stock"`         // nil means the stock is not tracked
+	MinQuantity   uint    `json:"minQuantity"`   // 0 means no minimum
+	MaxQuantity   uint    `json:"maxQuantity"`   // 0 means CART_MAX_QUANTITY
+	QuantityStep  uint    `json:"quantityStep"`  // sold in multiples of this, 0 or 1 means any quantity
+	PurchaseLimit uint    `json:"purchaseLimit"` // per customer over all orders, 0 means unlimited
+	Carts         []Cart  `gorm:"foreignKey:ProductId"`
 }
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode is a single-use 2FA backup code, stored as a SHA-256 hash
+type RecoveryCode struct {
+	gorm.Model
+	UserId   uint       `json:"userId" gorm:"index"`
+	CodeHash string     `json:"-"`
+	UsedAt   *time.Time `json:"usedAt"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a login on a device, or an admin's impersonation of the user when ImpersonatorId
+// is set. Its TokenID is carried in the JWT "jti" claim.
+type Session struct {
+	gorm.Model
+	UserId         uint       `json:"userId" gorm:"index"`
+	TokenID        string     `json:"-" gorm:"uniqueIndex"`
+	UserAgent      string     `json:"userAgent"`
+	IP             string     `json:"ip"`
+	LastActiveAt   time.Time  `json:"lastActiveAt"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	RevokedAt      *time.Time `json:"revokedAt"`
+	ImpersonatorId *uint      `json:"impersonatorId"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SigningKey is a JWT signing key. Retired keys are kept so tokens they signed stay valid until expiry.
+type SigningKey struct {
+	gorm.Model
+	Kid        string     `json:"kid" gorm:"uniqueIndex"`
+	Algorithm  string     `json:"algorithm"`
+	PrivateKey string     `json:"-"`
+	Active     bool       `json:"active"`
+	RetiredAt  *time.Time `json:"retiredAt"`
+}
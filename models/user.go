@@ -1,15 +1,25 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	Name     string  `json:"name"`
-	Email    string  `json:"email"`
-	Password string  `json:"password"`
-	Role     string  `json:"role"`
-	Carts    []Cart  `gorm:"foreignKey:UserId"`
-	Orders   []Order `gorm:"foreignKey:UserId"`
+	Name            string         `json:"name"`
+	Email           string         `json:"email"`
+	Password        string         `json:"-"`
+	Role            string         `json:"role"`
+	PendingEmail    string         `json:"pendingEmail"`
+	EmailVerifiedAt *time.Time     `json:"emailVerifiedAt"`
+	DeactivatedAt   *time.Time     `json:"deactivatedAt"`
+	AnonymizedAt    *time.Time     `json:"anonymizedAt"`
+	TotpSecret      string         `json:"-"`
+	TotpEnabled     bool           `json:"totpEnabled"`
+	TotpLastCounter int64          `json:"-"`
+	Carts           []Cart         `gorm:"foreignKey:UserId"`
+	Orders          []Order        `gorm:"foreignKey:UserId"`
+	RecoveryCodes   []RecoveryCode `gorm:"foreignKey:UserId"`
 }
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// UserIdentity links an account at an external OpenID Connect provider to a user
+type UserIdentity struct {
+	gorm.Model
+	UserId   uint   `json:"userId" gorm:"index"`
+	User     User   `gorm:"foreignKey:UserId"`
+	Provider string `json:"provider" gorm:"uniqueIndex:idx_user_identity_provider_subject"`
+	Subject  string `json:"subject" gorm:"uniqueIndex:idx_user_identity_provider_subject"`
+	Email    string `json:"email"`
+}
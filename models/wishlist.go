@@ -0,0 +1,23 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Wishlist is a named list of products. It can be opened by anyone with the link while ShareToken is set.
+type Wishlist struct {
+	gorm.Model
+	UserId     uint           `json:"userId" gorm:"index"`
+	User       User           `gorm:"foreignKey:UserId"`
+	Name       string         `json:"name"`
+	ShareToken *string        `json:"-" gorm:"uniqueIndex"`
+	Items      []WishlistItem `gorm:"foreignKey:WishlistId"`
+}
+
+// WishlistItem is a product on a wishlist
+type WishlistItem struct {
+	gorm.Model
+	WishlistId uint    `json:"wishlistId" gorm:"index"`
+	ProductId  uint    `json:"productId" gorm:"index"`
+	Product    Product `gorm:"foreignKey:ProductId"`
+}
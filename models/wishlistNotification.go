@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WishlistNotification is a queued email to the users who wishlisted a product, sent by
+// the wishlist notification worker
+type WishlistNotification struct {
+	gorm.Model
+	ProductId uint       `json:"productId" gorm:"index"`
+	Subject   string     `json:"subject"`
+	Body      string     `json:"body"`
+	SentAt    *time.Time `json:"sentAt" gorm:"index"`
+}
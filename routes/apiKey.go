@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"e-commerce/controllers"
+	"e-commerce/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAPIKeyRoutes(router *gin.Engine) {
+	apiKeyRoutes := router.Group("/api-keys")
+	{
+		apiKeyRoutes.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+		apiKeyRoutes.POST("/", controllers.CreateAPIKey)
+		apiKeyRoutes.GET("/", controllers.GetAPIKeys)
+		apiKeyRoutes.DELETE("/:id", controllers.RevokeAPIKey)
+		apiKeyRoutes.GET("/:id/audit", controllers.GetAPIKeyAuditLog)
+	}
+}
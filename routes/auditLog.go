@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"e-commerce/controllers"
+	"e-commerce/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAuditLogRoutes(router *gin.Engine) {
+	router.GET("/audit-logs", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.GetAuditLogs)
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"e-commerce/controllers"
+	"e-commerce/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAuthRoutes(router *gin.Engine) {
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
+	authRoutes := router.Group("/auth")
+	{
+		authRoutes.GET("/oidc/:provider/login", controllers.OIDCLogin)
+		authRoutes.GET("/oidc/:provider/callback", controllers.OIDCCallback)
+		authRoutes.POST("/keys/rotate", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.RotateSigningKey)
+	}
+}
@@ -10,10 +10,15 @@ import (
 func RegisterCartRoutes(router *gin.Engine) {
 	cartRoutes := router.Group("/cart")
 	{
-		cartRoutes.Use(middlewares.AuthMiddleware())
+		cartRoutes.Use(middlewares.OptionalAuthMiddleware())
 		cartRoutes.POST("/", controllers.AddToCart)
 		cartRoutes.GET("/", controllers.ViewCart)
+		cartRoutes.POST("/validate", controllers.ValidateCart)
+		cartRoutes.GET("/restore/:token", controllers.RestoreCart)
 		cartRoutes.PUT("/:id", controllers.UpdateCartItem)
 		cartRoutes.DELETE("/:id", controllers.RemoveFromCart)
+		cartRoutes.POST("/:id/save-for-later", controllers.SaveForLater)
+		cartRoutes.POST("/:id/move-to-cart", controllers.MoveToCart)
+		cartRoutes.POST("/:id/move-to-wishlist", controllers.MoveCartItemToWishlist)
 	}
 }
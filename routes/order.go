@@ -12,6 +12,17 @@ func RegisterOrderRoutes(router *gin.Engine) {
 	{
 		productRoutes.POST("/", middlewares.AuthMiddleware(), controllers.AddOrderFromCart)
 		productRoutes.GET("/", middlewares.AuthMiddleware(), controllers.GetMyOrders)
-		productRoutes.GET("/all", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.GetAllOrders)
+		productRoutes.POST("/:id/reorder", middlewares.AuthMiddleware(), controllers.ReorderOrder)
+		productRoutes.POST("/guest", controllers.GuestCheckout)
+		productRoutes.GET("/lookup/:token", controllers.LookupGuestOrder)
+		productRoutes.POST("/lookup/:token/account", controllers.CreateAccountFromGuestOrder)
+		productRoutes.POST("/claim", middlewares.AuthMiddleware(), controllers.ClaimGuestOrders)
+		productRoutes.GET("/all", middlewares.AuthMiddleware("orders:read"), middlewares.AdminMiddleware(), controllers.GetAllOrders)
+		productRoutes.GET("/export", middlewares.AuthMiddleware("orders:read"), middlewares.AdminMiddleware(), controllers.ExportOrders)
+		productRoutes.GET("/:id", middlewares.AuthMiddleware("orders:read"), controllers.GetOrder)
+		productRoutes.PUT("/:id/status", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.UpdateOrderStatus)
+		productRoutes.GET("/:id/messages", middlewares.AuthMiddleware(), controllers.GetOrderMessages)
+		productRoutes.POST("/:id/messages", middlewares.AuthMiddleware(), controllers.AddOrderMessage)
+		productRoutes.GET("/:id/messages/:messageId/attachment", middlewares.AuthMiddleware(), controllers.GetOrderMessageAttachment)
 	}
 }
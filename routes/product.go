@@ -10,10 +10,10 @@ import (
 func RegisterProductRoutes(router *gin.Engine) {
 	productRoutes := router.Group("/products")
 	{
-		productRoutes.GET("/", middlewares.AuthMiddleware(), controllers.GetProducts)
-		productRoutes.POST("/", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.CreateProduct)
-		productRoutes.GET("/:id", middlewares.AuthMiddleware(), controllers.GetProductByID)
-		productRoutes.PUT("/:id", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.UpdateProduct)
-		productRoutes.DELETE("/:id", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.DeleteProduct)
+		productRoutes.GET("/", middlewares.OptionalAuthMiddleware("products:read"), controllers.GetProducts)
+		productRoutes.POST("/", middlewares.AuthMiddleware("products:write"), middlewares.AdminMiddleware(), controllers.CreateProduct)
+		productRoutes.GET("/:id", middlewares.OptionalAuthMiddleware("products:read"), controllers.GetProductByID)
+		productRoutes.PUT("/:id", middlewares.AuthMiddleware("products:write"), middlewares.AdminMiddleware(), controllers.UpdateProduct)
+		productRoutes.DELETE("/:id", middlewares.AuthMiddleware("products:write"), middlewares.AdminMiddleware(), controllers.DeleteProduct)
 	}
 }
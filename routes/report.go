@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"e-commerce/controllers"
+	"e-commerce/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterReportRoutes(router *gin.Engine) {
+	reportRoutes := router.Group("/reports")
+	{
+		reportRoutes.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+		reportRoutes.GET("/sales", controllers.GetSalesReport)
+		reportRoutes.GET("/top-products", controllers.GetTopProductsReport)
+		reportRoutes.GET("/customers", controllers.GetCustomerReport)
+		reportRoutes.GET("/refunds", controllers.GetRefundReport)
+		reportRoutes.GET("/abandoned-carts", controllers.GetAbandonedCartReport)
+	}
+}
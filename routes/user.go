@@ -2,6 +2,8 @@ package routes
 
 import (
     "e-commerce/controllers"
+    "e-commerce/middlewares"
+
     "github.com/gin-gonic/gin"
 )
 
@@ -10,5 +12,27 @@ func RegisterUserRoutes(router *gin.Engine) {
     {
         userRoutes.POST("/register", controllers.RegisterUser)
         userRoutes.POST("/login", controllers.LoginUser)
+        userRoutes.POST("/login/2fa", controllers.VerifyTwoFactorLogin)
+        userRoutes.POST("/verify-email", controllers.VerifyEmail)
+        userRoutes.GET("/me", middlewares.AuthMiddleware(), controllers.GetProfile)
+        userRoutes.PATCH("/me", middlewares.AuthMiddleware(), controllers.UpdateProfile)
+        userRoutes.POST("/me/password", middlewares.AuthMiddleware(), controllers.ChangePassword)
+        userRoutes.POST("/me/email", middlewares.AuthMiddleware(), controllers.ChangeEmail)
+        userRoutes.POST("/me/deactivate", middlewares.AuthMiddleware(), controllers.DeactivateAccount)
+        userRoutes.GET("/me/sessions", middlewares.AuthMiddleware(), controllers.GetSessions)
+        userRoutes.DELETE("/me/sessions/:id", middlewares.AuthMiddleware(), controllers.RevokeSession)
+        userRoutes.POST("/me/sessions/revoke-others", middlewares.AuthMiddleware(), controllers.RevokeOtherSessions)
+        userRoutes.POST("/me/data-export", middlewares.AuthMiddleware(), controllers.RequestDataExport)
+        userRoutes.POST("/me/erasure", middlewares.AuthMiddleware(), controllers.RequestErasure)
+        userRoutes.GET("/me/data-requests", middlewares.AuthMiddleware(), controllers.GetDataRequests)
+        userRoutes.GET("/me/data-requests/:id", middlewares.AuthMiddleware(), controllers.GetDataRequest)
+        userRoutes.GET("/me/data-requests/:id/download", middlewares.AuthMiddleware(), controllers.DownloadDataExport)
+        userRoutes.POST("/2fa/setup", middlewares.AuthMiddleware(), controllers.SetupTwoFactor)
+        userRoutes.POST("/2fa/confirm", middlewares.AuthMiddleware(), controllers.ConfirmTwoFactor)
+        userRoutes.POST("/2fa/recovery-codes", middlewares.AuthMiddleware(), controllers.RegenerateRecoveryCodes)
+        userRoutes.POST("/2fa/disable", middlewares.AuthMiddleware(), controllers.DisableTwoFactor)
+        userRoutes.GET("/login-attempts", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.GetLoginAttempts)
+        userRoutes.POST("/:id/unlock", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.UnlockUser)
+        userRoutes.POST("/:id/impersonate", middlewares.AuthMiddleware(), middlewares.AdminMiddleware(), controllers.ImpersonateUser)
     }
-}
\ No newline at end of file
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"e-commerce/controllers"
+	"e-commerce/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterWishlistRoutes(router *gin.Engine) {
+	wishlistRoutes := router.Group("/wishlists")
+	{
+		wishlistRoutes.GET("/shared/:token", controllers.GetSharedWishlist)
+		wishlistRoutes.GET("/", middlewares.AuthMiddleware(), controllers.GetWishlists)
+		wishlistRoutes.POST("/", middlewares.AuthMiddleware(), controllers.CreateWishlist)
+		wishlistRoutes.GET("/:id", middlewares.AuthMiddleware(), controllers.GetWishlist)
+		wishlistRoutes.PATCH("/:id", middlewares.AuthMiddleware(), controllers.UpdateWishlist)
+		wishlistRoutes.DELETE("/:id", middlewares.AuthMiddleware(), controllers.DeleteWishlist)
+		wishlistRoutes.POST("/:id/items", middlewares.AuthMiddleware(), controllers.AddWishlistItem)
+		wishlistRoutes.DELETE("/:id/items/:itemId", middlewares.AuthMiddleware(), controllers.RemoveWishlistItem)
+		wishlistRoutes.POST("/:id/items/:itemId/move-to-cart", middlewares.AuthMiddleware(), controllers.MoveWishlistItemToCart)
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalURLPrefix is the path the local store is served under
+const LocalURLPrefix = "/uploads"
+
+// LocalDir returns the directory the local store writes to
+func LocalDir() string {
+	if dir := os.Getenv("STORAGE_LOCAL_DIR"); dir != "" {
+		return dir
+	}
+	return "uploads"
+}
+
+// Local stores objects as files in a directory. It only works for a single instance, or
+// when the directory is shared between instances.
+type Local struct {
+	Dir string
+}
+
+// NewLocal returns a store that writes to the directory
+func NewLocal(dir string) *Local {
+	return &Local{Dir: dir}
+}
+
+func (l *Local) Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial object
+	file, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filePath)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filePath)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// URL returns the path the object is served under by the application
+func (l *Local) URL(key string) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	return LocalURLPrefix + "/" + key, nil
+}
+
+// path maps a key to a file in the directory, rejecting keys that would leave it
+func (l *Local) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned != "/"+key || strings.HasPrefix(path.Base(key), ".") {
+		return "", errors.New("invalid object key")
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
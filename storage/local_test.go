@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalPathRejectsTraversal(t *testing.T) {
+	store := NewLocal(t.TempDir())
+
+	for _, key := range []string{
+		"",
+		"../secret",
+		"products/../../secret",
+		"/etc/passwd",
+		"products//photo.jpg",
+		"products/./photo.jpg",
+		"products/",
+		"products/.hidden",
+		"..",
+	} {
+		if _, err := store.path(key); err == nil {
+			t.Errorf("key %q was accepted", key)
+		}
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("put with key %q succeeded", key)
+		}
+		if _, err := store.URL(key); err == nil {
+			t.Errorf("URL for key %q was built", key)
+		}
+	}
+
+	// Nothing was written outside the directory
+	if _, err := os.Stat(filepath.Join(filepath.Dir(store.Dir), "secret")); !os.IsNotExist(err) {
+		t.Fatal("a file was written outside the store")
+	}
+}
+
+func TestLocalPutGetDelete(t *testing.T) {
+	store := NewLocal(t.TempDir())
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "products/photo.jpg", strings.NewReader("photo"), 5, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	object, err := store.Get(ctx, "products/photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(object)
+	object.Close()
+	if string(got) != "photo" {
+		t.Fatalf("get returned %q", got)
+	}
+
+	if link, _ := store.URL("products/photo.jpg"); link != "/uploads/products/photo.jpg" {
+		t.Errorf("unexpected URL %s", link)
+	}
+
+	if err := store.Delete(ctx, "products/photo.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "products/photo.jpg"); err != nil {
+		t.Errorf("deleting a missing object failed: %v", err)
+	}
+}
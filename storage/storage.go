@@ -0,0 +1,58 @@
+// Package storage keeps uploaded files in a blob store, so that several instances of the
+// application can share them. Files are addressed by object keys such as
+// "products/1700000000_photo.jpg".
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Storage is a blob store for uploaded files
+type Storage interface {
+	// Put stores the content under the key, replacing any existing object
+	Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error
+	// Get opens the object stored under the key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under the key
+	Delete(ctx context.Context, key string) error
+	// URL returns a URL clients can download the object from
+	URL(key string) (string, error)
+}
+
+// Default is the store used by the application, set up by Init
+var Default Storage
+
+// Init sets up the store selected by STORAGE_DRIVER: "local" (the default) or "s3"
+func Init() error {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		Default = NewLocal(LocalDir())
+	case "s3":
+		s3, err := NewS3FromEnv()
+		if err != nil {
+			return err
+		}
+		Default = s3
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+	return nil
+}
+
+// URL returns the download URL of an object, or an empty string when it cannot be built.
+// Files stored before they had an object key are returned at their old path.
+func URL(key string, legacyPath string) string {
+	if key == "" {
+		return legacyPath
+	}
+	url, err := Default.URL(key)
+	if err != nil {
+		log.Println("Failed to build URL for", key, err)
+		return ""
+	}
+	return url
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+)
+
+// GetEnvInt reads an integer from the environment, falling back to the given
+// default when the variable is unset or not a valid number
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetEnvFloat reads a decimal number from the environment, falling back to the given
+// default when the variable is unset or not a valid number
+func GetEnvFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
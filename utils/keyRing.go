@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"e-commerce/db"
+	"e-commerce/models"
+
+	"github.com/dgrijalva/jwt-go"
+	"gorm.io/gorm"
+)
+
+const (
+	// keyRingRefresh is how often keys rotated by other instances are picked up
+	keyRingRefresh = 5 * time.Minute
+	// retiredKeyLifetime keeps retired keys long enough for every token they signed to expire
+	retiredKeyLifetime = 48 * time.Hour
+)
+
+// JSONWebKey is a public key as published in the JWKS endpoint
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type ringKey struct {
+	kid       string
+	algorithm string
+	private   crypto.Signer
+}
+
+// keyRing caches the signing keys stored in the database
+type keyRing struct {
+	mu       sync.RWMutex
+	keys     map[string]*ringKey
+	active   *ringKey
+	loadedAt time.Time
+}
+
+var signingKeys = &keyRing{}
+
+// SigningMethodEdDSA implements Ed25519 signatures, which jwt-go v3 does not ship
+type SigningMethodEdDSA struct{}
+
+func (m *SigningMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *SigningMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return errors.New("signature is invalid")
+	}
+	return nil
+}
+
+func (m *SigningMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+func init() {
+	jwt.RegisterSigningMethod("EdDSA", func() jwt.SigningMethod {
+		return &SigningMethodEdDSA{}
+	})
+}
+
+// InitKeyRing loads the signing keys and creates the first one when none is active.
+// The algorithm of new keys is set with JWT_SIGNING_ALG (RS256 or EdDSA, default RS256).
+func InitKeyRing() error {
+	if err := signingKeys.load(); err != nil {
+		return err
+	}
+	if signingKeys.current() == nil {
+		_, err := RotateSigningKey()
+		return err
+	}
+	return nil
+}
+
+// RotateSigningKey creates a new active key and retires the previous ones. Retired keys
+// still verify tokens until they are pruned, so in-flight tokens are not invalidated.
+func RotateSigningKey() (*models.SigningKey, error) {
+	algorithm := os.Getenv("JWT_SIGNING_ALG")
+	if algorithm == "" {
+		algorithm = "RS256"
+	}
+
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, errors.New("unsupported JWT_SIGNING_ALG " + algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	kidBytes := make([]byte, 8)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return nil, err
+	}
+
+	signingKey := models.SigningKey{
+		Kid:        hex.EncodeToString(kidBytes),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		Active:     true,
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SigningKey{}).Where("active = ?", true).
+			Updates(map[string]interface{}{"active": false, "retired_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&signingKey).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingKey, signingKeys.load()
+}
+
+// JWKS returns the public keys that currently verify tokens
+func JWKS() []JSONWebKey {
+	signingKeys.refreshIfStale()
+
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+
+	jwks := []JSONWebKey{}
+	for _, key := range signingKeys.keys {
+		jwk := JSONWebKey{Kid: key.kid, Use: "sig", Alg: key.algorithm}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+// load replaces the cached keys with the active and recently retired keys from the database
+func (r *keyRing) load() error {
+	var stored []models.SigningKey
+	if err := db.DB.Where("active = ? OR retired_at > ?", true, time.Now().Add(-retiredKeyLifetime)).
+		Order("created_at DESC").Find(&stored).Error; err != nil {
+		return err
+	}
+
+	keys := map[string]*ringKey{}
+	var active *ringKey
+	for _, signingKey := range stored {
+		block, _ := pem.Decode([]byte(signingKey.PrivateKey))
+		if block == nil {
+			continue
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			continue
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			continue
+		}
+
+		key := &ringKey{kid: signingKey.Kid, algorithm: signingKey.Algorithm, private: signer}
+		keys[key.kid] = key
+		if signingKey.Active && active == nil {
+			active = key
+		}
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.active = active
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *keyRing) refreshIfStale() {
+	r.mu.RLock()
+	stale := time.Since(r.loadedAt) > keyRingRefresh
+	r.mu.RUnlock()
+	if stale {
+		r.load()
+	}
+}
+
+func (r *keyRing) current() *ringKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active
+}
+
+// lookup finds a key by ID, reloading once in case another instance just rotated
+func (r *keyRing) lookup(kid string) *ringKey {
+	r.refreshIfStale()
+
+	r.mu.RLock()
+	key := r.keys[kid]
+	r.mu.RUnlock()
+	if key != nil {
+		return key
+	}
+
+	// Unknown kids could come from forged tokens, so do not hit the database for each one
+	r.mu.RLock()
+	recentlyLoaded := time.Since(r.loadedAt) < 10*time.Second
+	r.mu.RUnlock()
+	if recentlyLoaded || r.load() != nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[kid]
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// Mail is the mailer used by the application. InitMailer makes it send through SMTP when
+// SMTP_HOST is set; otherwise it only logs messages, which is convenient in development.
+var Mail Mailer = logMailer{}
+
+// InitMailer configures Mail from the SMTP_* environment variables. It is called from main
+// after the .env file is loaded, since the variables are not set yet at package init.
+func InitMailer() {
+	Mail = newMailerFromEnv()
+	if _, ok := Mail.(logMailer); ok {
+		log.Println("SMTP_HOST is not set, emails are written to the log instead of being sent")
+	}
+}
+
+// smtpMailer sends mail through an SMTP server
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func (m *smtpMailer) Send(to, subject, body string) error {
+	// Refuse header injection through the recipient or subject
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+
+	message := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(message))
+}
+
+// logMailer writes messages to the log instead of sending them
+type logMailer struct{}
+
+func (logMailer) Send(to, subject, body string) error {
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+func newMailerFromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return logMailer{}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	return &smtpMailer{addr: host + ":" + port, auth: auth, from: os.Getenv("SMTP_FROM")}
+}
+
+// AppURL returns the public URL of the frontend used in links sent to users
+func AppURL() string {
+	if url := os.Getenv("APP_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return "http://localhost:3000"
+}
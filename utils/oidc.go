@@ -0,0 +1,369 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// OIDCProvider is an OpenID Connect identity provider configured through the environment.
+// For a provider named "google" the variables are OIDC_GOOGLE_ISSUER, OIDC_GOOGLE_CLIENT_ID,
+// OIDC_GOOGLE_CLIENT_SECRET, OIDC_GOOGLE_REDIRECT_URL and optionally OIDC_GOOGLE_SCOPES.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCDiscovery holds the endpoints published at /.well-known/openid-configuration
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// OIDCClaims are the ID token claims used to identify the user
+type OIDCClaims struct {
+	Issuer        string       `json:"iss"`
+	Subject       string       `json:"sub"`
+	Audience      oidcAudience `json:"aud"`
+	ExpiresAt     int64        `json:"exp"`
+	IssuedAt      int64        `json:"iat"`
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified oidcBool     `json:"email_verified"`
+	Name          string       `json:"name"`
+}
+
+// Valid checks the time based claims, allowing a minute of clock skew
+func (c *OIDCClaims) Valid() error {
+	now := time.Now().Unix()
+	if c.ExpiresAt == 0 || now > c.ExpiresAt+60 {
+		return errors.New("id token is expired")
+	}
+	if c.IssuedAt > now+60 {
+		return errors.New("id token is issued in the future")
+	}
+	return nil
+}
+
+// oidcAudience accepts the "aud" claim as either a string or a list of strings
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = []string{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// oidcBool accepts booleans sent as strings, which some providers do for email_verified
+type oidcBool bool
+
+func (b *oidcBool) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	*b = oidcBool(value == "true")
+	return nil
+}
+
+var (
+	oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+	oidcCacheMu     sync.Mutex
+	oidcDiscoveries = map[string]*OIDCDiscovery{}
+	oidcKeys        = map[string]map[string]interface{}{}
+)
+
+// GetOIDCProvider returns the configuration of a provider listed in OIDC_PROVIDERS
+func GetOIDCProvider(name string) (*OIDCProvider, error) {
+	name = strings.ToLower(name)
+	enabled := false
+	for _, provider := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		if strings.ToLower(strings.TrimSpace(provider)) == name {
+			enabled = true
+		}
+	}
+	if !enabled || name == "" {
+		return nil, errors.New("unknown provider")
+	}
+
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	provider := &OIDCProvider{
+		Name:         name,
+		Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+		ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+		ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+	if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+		provider.Scopes = strings.Fields(scopes)
+	}
+	if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+		return nil, fmt.Errorf("provider %s is not fully configured", name)
+	}
+	return provider, nil
+}
+
+// GeneratePKCE returns a code verifier and its S256 code challenge
+func GeneratePKCE() (string, string, error) {
+	verifier, err := RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// Discover fetches and caches the provider's discovery document
+func (p *OIDCProvider) Discover(ctx context.Context) (*OIDCDiscovery, error) {
+	oidcCacheMu.Lock()
+	cached := oidcDiscoveries[p.Issuer]
+	oidcCacheMu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	var discovery OIDCDiscovery
+	if err := oidcGetJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return nil, errors.New("discovery issuer does not match the configured issuer")
+	}
+
+	oidcCacheMu.Lock()
+	oidcDiscoveries[p.Issuer] = &discovery
+	oidcCacheMu.Unlock()
+	return &discovery, nil
+}
+
+// AuthCodeURL builds the authorization request for the code flow with PKCE
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the raw ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || tokenResponse.IDToken == "" {
+		return "", fmt.Errorf("token exchange failed: %s", tokenResponse.Error)
+	}
+	return tokenResponse.IDToken, nil
+}
+
+// VerifyIDToken checks the ID token signature against the provider's JWKS and validates
+// the issuer, audience, expiry and nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*OIDCClaims, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &OIDCClaims{}
+	token, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, discovery.JwksURI, kid)
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid id token")
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != p.Issuer {
+		return nil, errors.New("id token issuer mismatch")
+	}
+	audienceMatches := false
+	for _, audience := range claims.Audience {
+		if audience == p.ClientID {
+			audienceMatches = true
+		}
+	}
+	if !audienceMatches {
+		return nil, errors.New("id token audience mismatch")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// signingKey looks up a key by ID, refreshing the JWKS once when the key is unknown
+func (p *OIDCProvider) signingKey(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		oidcCacheMu.Lock()
+		keys := oidcKeys[jwksURI]
+		oidcCacheMu.Unlock()
+
+		if keys != nil {
+			if key, ok := keys[kid]; ok {
+				return key, nil
+			}
+			// Providers that publish a single key may omit the kid
+			if kid == "" && len(keys) == 1 {
+				for _, key := range keys {
+					return key, nil
+				}
+			}
+		}
+
+		if attempt == 0 {
+			fetched, err := fetchJWKS(ctx, jwksURI)
+			if err != nil {
+				return nil, err
+			}
+			oidcCacheMu.Lock()
+			oidcKeys[jwksURI] = fetched
+			oidcCacheMu.Unlock()
+		}
+	}
+	return nil, errors.New("signing key not found")
+}
+
+// fetchJWKS downloads a JSON Web Key Set and decodes its RSA and EC keys
+func fetchJWKS(ctx context.Context, jwksURI string) (map[string]interface{}, error) {
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := oidcGetJSON(ctx, jwksURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{}
+	for _, key := range jwks.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		switch key.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(key.N)
+			e, errE := base64.RawURLEncoding.DecodeString(key.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if key.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(key.X)
+			y, errY := base64.RawURLEncoding.DecodeString(key.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[key.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func oidcGetJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
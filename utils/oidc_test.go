@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	testClientID    = "shop-client"
+	testRedirectURL = "http://localhost:8000/auth/oidc/mock/callback"
+)
+
+// mockIssuer is a local OpenID Connect provider serving discovery, JWKS and token endpoints.
+// Codes are handed out by authorize, and the token endpoint checks the PKCE verifier.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]url.Values
+	// claims can change the ID token claims before they are signed
+	claims func(jwt.MapClaims)
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{key: key, codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(OIDCDiscovery{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JwksURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// authorize stands in for the user logging in at the provider and returns the code
+func (m *mockIssuer) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := RandomToken(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.codes[code] = parsed.Query()
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	request, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || request.Get("code_challenge_method") != "S256" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != request.Get("code_challenge") ||
+		r.PostForm.Get("client_id") != request.Get("client_id") ||
+		r.PostForm.Get("redirect_uri") != request.Get("redirect_uri") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"sub":            "mock-user-1",
+		"aud":            request.Get("client_id"),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          request.Get("nonce"),
+		"email":          "customer@example.com",
+		"email_verified": true,
+		"name":           "Mock Customer",
+	}
+	if m.claims != nil {
+		m.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock-key"
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+func (m *mockIssuer) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+		Scopes:      []string{"openid", "email", "profile"},
+	}
+}
+
+// login runs the flow up to the token exchange and returns the ID token and the nonce
+func (m *mockIssuer) login(t *testing.T, provider *OIDCProvider, verifierOverride string) (string, string, error) {
+	t.Helper()
+	ctx := context.Background()
+	verifier, challenge, err := GeneratePKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, _ := RandomToken(16)
+	authURL, err := provider.AuthCodeURL(ctx, "state", nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifierOverride != "" {
+		verifier = verifierOverride
+	}
+	idToken, err := provider.Exchange(ctx, m.authorize(t, authURL), verifier)
+	return idToken, nonce, err
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+
+	idToken, nonce, err := issuer.login(t, provider, "")
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	claims, err := provider.VerifyIDToken(context.Background(), idToken, nonce)
+	if err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+	if claims.Subject != "mock-user-1" || claims.Email != "customer@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	issuer := newMockIssuer(t)
+
+	otherVerifier, _, _ := GeneratePKCE()
+	if _, _, err := issuer.login(t, issuer.provider(), otherVerifier); err == nil {
+		t.Fatal("exchange with a verifier that does not match the challenge succeeded")
+	}
+}
+
+func TestOIDCVerifyRejectsNonceMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+
+	idToken, _, err := issuer.login(t, provider, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), idToken, "another-login"); err == nil {
+		t.Fatal("ID token issued for another nonce was accepted")
+	}
+}
+
+func TestOIDCVerifyRejectsForeignTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+	}{
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://attacker.example.com" }},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"audience list without us", func(c jwt.MapClaims) { c["aud"] = []string{"a", "b"} }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issuer := newMockIssuer(t)
+			issuer.claims = test.claims
+			provider := issuer.provider()
+
+			idToken, nonce, err := issuer.login(t, provider, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := provider.VerifyIDToken(context.Background(), idToken, nonce); err == nil {
+				t.Fatal("ID token was accepted")
+			}
+		})
+	}
+}
+
+func TestOIDCUnverifiedEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		verified interface{}
+	}{
+		{"false", false},
+		{"false as string", "false"},
+		{"missing", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issuer := newMockIssuer(t)
+			issuer.claims = func(c jwt.MapClaims) {
+				if test.verified == nil {
+					delete(c, "email_verified")
+				} else {
+					c["email_verified"] = test.verified
+				}
+			}
+			provider := issuer.provider()
+
+			idToken, nonce, err := issuer.login(t, provider, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := provider.VerifyIDToken(context.Background(), idToken, nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.EmailVerified {
+				t.Fatal("email was reported as verified")
+			}
+		})
+	}
+}
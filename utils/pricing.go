@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"math"
+
+	"e-commerce/models"
+)
+
+// Discount reduces the price of a cart, e.g. a coupon. Amount receives the cart subtotal
+// and returns how much is taken off it.
+type Discount interface {
+	Amount(subtotal float64) float64
+}
+
+// PricedLine is a cart item with its price at the current product price
+type PricedLine struct {
+	Item      models.Cart
+	UnitPrice float64
+	Subtotal  float64
+}
+
+// CartPricing is the price breakdown of a cart. Checkout and the cart view both use
+// PriceCart, so the customer sees exactly what the order will charge.
+type CartPricing struct {
+	Lines     []PricedLine
+	ItemCount uint
+	Subtotal  float64
+	Discount  float64
+	Tax       float64
+	Shipping  float64
+	Total     float64
+}
+
+// PriceCart prices cart items at the current product prices. Products that were deleted
+// cannot be bought and are left out. Tax is charged on the discounted subtotal at TAX_RATE
+// percent; SHIPPING_FLAT is charged unless the discounted subtotal reaches
+// FREE_SHIPPING_THRESHOLD.
+func PriceCart(items []models.Cart, discounts ...Discount) CartPricing {
+	var pricing CartPricing
+	for _, item := range items {
+		if item.Product.ID == 0 || item.Product.DeletedAt.Valid {
+			continue
+		}
+		line := PricedLine{
+			Item:      item,
+			UnitPrice: item.Product.Price,
+			Subtotal:  roundCents(float64(item.Quantity) * item.Product.Price),
+		}
+		pricing.Lines = append(pricing.Lines, line)
+		pricing.ItemCount += item.Quantity
+		pricing.Subtotal += line.Subtotal
+	}
+	pricing.Subtotal = roundCents(pricing.Subtotal)
+
+	for _, discount := range discounts {
+		pricing.Discount += discount.Amount(pricing.Subtotal)
+	}
+	pricing.Discount = roundCents(math.Min(pricing.Discount, pricing.Subtotal))
+
+	taxable := pricing.Subtotal - pricing.Discount
+	pricing.Tax = roundCents(taxable * GetEnvFloat("TAX_RATE", 0) / 100)
+
+	threshold := GetEnvFloat("FREE_SHIPPING_THRESHOLD", 0)
+	if len(pricing.Lines) > 0 && (threshold <= 0 || taxable < threshold) {
+		pricing.Shipping = roundCents(GetEnvFloat("SHIPPING_FLAT", 0))
+	}
+
+	pricing.Total = roundCents(taxable + pricing.Tax + pricing.Shipping)
+	return pricing
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// PercentDiscount takes a percentage off the subtotal
+type PercentDiscount float64
+
+// Amount returns the percentage of the subtotal
+func (p PercentDiscount) Amount(subtotal float64) float64 {
+	return subtotal * float64(p) / 100
+}
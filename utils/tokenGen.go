@@ -1,29 +1,92 @@
 package utils
 
 import (
-	"os"
+	"errors"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-var JwtSecret = []byte(os.Getenv("SECRET"))
+// PurposeTwoFactor marks a short-lived token that can only be exchanged for a session after a 2FA check
+const PurposeTwoFactor = "2fa"
 
+// Claims identify the user a token acts as. ActorID is set when an admin impersonates
+// the user, in which case ReadOnly limits the token to safe methods.
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID   uint   `json:"user_id"`
+	Role     string `json:"role"`
+	MFA      bool   `json:"mfa,omitempty"`
+	Purpose  string `json:"purpose,omitempty"`
+	ActorID  uint   `json:"actor_id,omitempty"`
+	ReadOnly bool   `json:"read_only,omitempty"`
 	jwt.StandardClaims
 }
 
-func GenerateJWT(userID uint, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// SessionTTL is the lifetime of a login session and its token
+const SessionTTL = 24 * time.Hour
+
+// GenerateJWT issues the token of a login session, identified by its "jti" claim
+func GenerateJWT(userID uint, role string, mfa bool, sessionID string) (string, error) {
 	claims := &Claims{
 		UserID: userID,
 		Role:   role,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+		MFA:    mfa,
+	}
+	claims.Id = sessionID
+	return signClaims(claims, SessionTTL)
+}
+
+// GenerateChallengeJWT issues the token returned by login when a second factor is still required
+func GenerateChallengeJWT(userID uint, role string) (string, error) {
+	return signClaims(&Claims{
+		UserID:  userID,
+		Role:    role,
+		Purpose: PurposeTwoFactor,
+	}, 5*time.Minute)
+}
+
+// GenerateImpersonationJWT issues a short-lived token that lets an admin act as a user. Like
+// login tokens it belongs to a session, so it can be revoked.
+func GenerateImpersonationJWT(userID uint, role string, actorID uint, readOnly bool, sessionID string, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		UserID:   userID,
+		Role:     role,
+		ActorID:  actorID,
+		ReadOnly: readOnly,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JwtSecret)
+	claims.Id = sessionID
+	return signClaims(claims, ttl)
+}
+
+// ParseJWT validates a token and returns its claims. Tokens are verified with the key named
+// by their "kid" header.
+func ParseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := signingKeys.lookup(kid)
+		if key == nil || token.Method.Alg() != key.algorithm {
+			return nil, errors.New("unknown signing key")
+		}
+		return key.private.Public(), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// signClaims signs the claims with the active key of the key ring
+func signClaims(claims *Claims, ttl time.Duration) (string, error) {
+	signingKeys.refreshIfStale()
+	key := signingKeys.current()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	claims.IssuedAt = time.Now().Unix()
+	claims.ExpiresAt = time.Now().Add(ttl).Unix()
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.algorithm), claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
 }
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC 6238 appendix B vectors for SHA-1. The RFC lists 8 digits, the last 6 are the
+// codes authenticator apps show.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		if code := totpCode([]byte("12345678901234567890"), vector.unix/totpPeriod); code != vector.code {
+			t.Errorf("time %d: got %s, want %s", vector.unix, code, vector.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		now := time.Unix(vector.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, vector.code, now)
+		if !ok || step != vector.unix/totpPeriod {
+			t.Errorf("time %d: got (%d, %t), want (%d, true)", vector.unix, step, ok, vector.unix/totpPeriod)
+		}
+	}
+
+	// Lower case secrets and surrounding spaces are accepted
+	if _, ok := ValidateTOTP(" "+"gezdgnbvgy3tqojqgezdgnbvgy3tqojq", " 287082 ", time.Unix(59, 0)); !ok {
+		t.Error("a lower case secret was rejected")
+	}
+
+	// One period of clock skew is allowed either way, two are not
+	for _, test := range []struct {
+		offset int64
+		ok     bool
+	}{
+		{-totpPeriod, true},
+		{totpPeriod, true},
+		{-2 * totpPeriod, false},
+		{2 * totpPeriod, false},
+	} {
+		if _, ok := ValidateTOTP(rfc6238Secret, "050471", time.Unix(1111111111+test.offset, 0)); ok != test.ok {
+			t.Errorf("offset %ds: ok is %t, want %t", test.offset, ok, test.ok)
+		}
+	}
+
+	for _, code := range []string{"050472", "50471", "0504710", "", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(1111111111, 0)); ok {
+			t.Errorf("code %q was accepted", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "050471", time.Unix(1111111111, 0)); ok {
+		t.Error("an invalid secret was accepted")
+	}
+}